@@ -6,6 +6,7 @@ import (
 
 	"github.com/golang/protobuf/proto"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/grpclog"
 	"google.golang.org/grpc/status"
 )
 
@@ -45,6 +46,19 @@ func Error(code Code, message string, errs ...error) *Status {
 	return &Status{s}
 }
 
+// ErrorWithDetails new status with code, message and structured details like errdetails.BadRequest.
+// Details which can not be marshaled are logged and dropped, the status keeps code and message.
+func ErrorWithDetails(code Code, message string, details ...proto.Message) *Status {
+	s := status.New(codes.Code(code), message)
+	ds, err := s.WithDetails(details...)
+	if err != nil {
+		grpclog.Errorf("Failed to add details to status %q: %v", message, err)
+		return &Status{s}
+	}
+
+	return &Status{ds}
+}
+
 // Errorf new status with code and message
 func Errorf(code Code, format string, args ...interface{}) *Status {
 	return &Status{status.Newf(codes.Code(code), format, args...)}
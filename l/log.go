@@ -1,10 +1,83 @@
 package l
 
 import (
+	"context"
+
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 // Logger wraps zap.Logger
 type Logger struct {
 	*zap.Logger
 }
+
+type fieldsKey struct{}
+
+// WithFields returns a copy of ctx carrying fields, Logger.Ctx attaches them to log lines.
+// Fields replace those of ctx with the same key.
+func WithFields(ctx context.Context, fields ...zapcore.Field) context.Context {
+	prev := Fields(ctx)
+	merged := make([]zapcore.Field, 0, len(prev)+len(fields))
+	for _, f := range prev {
+		if !hasKey(fields, f.Key) {
+			merged = append(merged, f)
+		}
+	}
+
+	// capped so appending to Fields(ctx) copies instead of sharing the array
+	merged = append(merged, fields...)
+	return context.WithValue(ctx, fieldsKey{}, merged[:len(merged):len(merged)])
+}
+
+func hasKey(fields []zapcore.Field, key string) bool {
+	for _, f := range fields {
+		if f.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Fields returns the fields carried by ctx
+func Fields(ctx context.Context) []zapcore.Field {
+	fields, _ := ctx.Value(fieldsKey{}).([]zapcore.Field)
+	return fields
+}
+
+// Ctx returns a logger attaching the fields of ctx, like the request id, to every line.
+// Lines logged without it, or without the *Ctx methods, do not carry the fields of ctx.
+func (lg Logger) Ctx(ctx context.Context) Logger {
+	fields := Fields(ctx)
+	if len(fields) == 0 {
+		return lg
+	}
+
+	return Logger{lg.Logger.With(fields...)}
+}
+
+// DebugCtx logs at debug level with the fields of ctx
+func (lg Logger) DebugCtx(ctx context.Context, msg string, fields ...zapcore.Field) {
+	lg.skipCaller().Debug(msg, append(Fields(ctx), fields...)...)
+}
+
+// InfoCtx logs at info level with the fields of ctx
+func (lg Logger) InfoCtx(ctx context.Context, msg string, fields ...zapcore.Field) {
+	lg.skipCaller().Info(msg, append(Fields(ctx), fields...)...)
+}
+
+// WarnCtx logs at warn level with the fields of ctx
+func (lg Logger) WarnCtx(ctx context.Context, msg string, fields ...zapcore.Field) {
+	lg.skipCaller().Warn(msg, append(Fields(ctx), fields...)...)
+}
+
+// ErrorCtx logs at error level with the fields of ctx
+func (lg Logger) ErrorCtx(ctx context.Context, msg string, fields ...zapcore.Field) {
+	lg.skipCaller().Error(msg, append(Fields(ctx), fields...)...)
+}
+
+// skipCaller skips the *Ctx method so lines report its caller
+func (lg Logger) skipCaller() *zap.Logger {
+	return lg.Logger.WithOptions(zap.AddCallerSkip(1))
+}
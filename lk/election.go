@@ -0,0 +1,72 @@
+package lk
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Election elects one leader among the processes campaigning for the same key
+type Election struct {
+	locker *Locker
+	key    string
+	ttl    time.Duration
+	leader int32
+}
+
+// NewElection create new election on key, leadership expires ttl after its holder stops refreshing it
+func NewElection(locker *Locker, key string, ttl time.Duration) (*Election, error) {
+	if ttl < time.Millisecond {
+		return nil, ErrInvalidTTL
+	}
+
+	return &Election{
+		locker: locker,
+		key:    key,
+		ttl:    ttl,
+	}, nil
+}
+
+// Run campaigns for leadership every third of ttl until ctx is done.
+// While leader it calls fn with the fencing token, the context passed to fn is cancelled when leadership is lost
+// and fn should return then. Leadership is released when fn returns.
+func (e *Election) Run(ctx context.Context, fn func(ctx context.Context, token int64)) error {
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		lock, err := e.locker.Obtain(e.key, e.ttl)
+		switch err {
+		case nil:
+			e.lead(ctx, lock, fn)
+		case ErrNotObtained:
+		default:
+			e.locker.handleError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// IsLeader reports whether Run is calling fn
+func (e *Election) IsLeader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+func (e *Election) lead(ctx context.Context, lock *Lock, fn func(ctx context.Context, token int64)) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	atomic.StoreInt32(&e.leader, 1)
+	defer atomic.StoreInt32(&e.leader, 0)
+
+	fn(lock.KeepAlive(ctx), lock.Token)
+
+	if err := lock.Release(); err != nil && err != ErrNotHeld {
+		e.locker.handleError(err)
+	}
+}
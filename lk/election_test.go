@@ -0,0 +1,73 @@
+package lk
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestElection(t *testing.T) {
+	locker, mr := newTestLocker(t)
+
+	leaders := make(chan int64, 10)
+	lost := make(chan int64, 10)
+	campaign := func(ctx context.Context, e *Election) {
+		_ = e.Run(ctx, func(ctx context.Context, token int64) {
+			leaders <- token
+			<-ctx.Done()
+			lost <- token
+		})
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+
+	e1, _ := NewElection(locker, "leader", 30*time.Millisecond)
+	go campaign(ctx1, e1)
+	if got := <-leaders; got != 1 {
+		t.Fatalf("first leader token = %v, want 1", got)
+	}
+
+	e2, _ := NewElection(locker, "leader", 30*time.Millisecond)
+	go campaign(ctx2, e2)
+
+	time.Sleep(40 * time.Millisecond)
+	if !e1.IsLeader() || e2.IsLeader() {
+		t.Errorf("IsLeader() = %v, %v, want only the first", e1.IsLeader(), e2.IsLeader())
+	}
+
+	// the leader stops, the other one takes over
+	cancel1()
+	if got := <-lost; got != 1 {
+		t.Errorf("lost leadership token = %v, want 1", got)
+	}
+	select {
+	case got := <-leaders:
+		if got != 2 {
+			t.Errorf("second leader token = %v, want 2", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no leader elected after the first stopped")
+	}
+
+	// leadership is lost when the lock is taken away
+	mr.Del(locker.prefix + "leader")
+	select {
+	case got := <-lost:
+		if got != 2 {
+			t.Errorf("lost leadership token = %v, want 2", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("leadership not lost after the lock was deleted")
+	}
+
+	select {
+	case got := <-leaders:
+		if got != 3 {
+			t.Errorf("re-elected leader token = %v, want 3", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no leader re-elected")
+	}
+}
@@ -0,0 +1,218 @@
+package lk
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/sunary/kitchen/id"
+)
+
+var (
+	// ErrNotObtained is returned when a lock is held by someone else
+	ErrNotObtained = errors.New("lk: lock not obtained")
+	// ErrNotHeld is returned when a lock expired or was taken over
+	ErrNotHeld = errors.New("lk: lock not held")
+	// ErrInvalidTTL is returned when ttl is shorter than a millisecond
+	ErrInvalidTTL = errors.New("lk: ttl must be at least 1ms")
+)
+
+type options struct {
+	prefix        string
+	retryInterval time.Duration
+	errorHandler  func(error)
+}
+
+// Option configures a Locker
+type Option func(*options)
+
+// WithPrefix sets the prefix of redis keys, default "lock:"
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+// WithRetryInterval sets how often ObtainWait tries again, default 100ms
+func WithRetryInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.retryInterval = d
+	}
+}
+
+// WithErrorHandler sets the callback of redis errors in KeepAlive and Election.Run
+func WithErrorHandler(fn func(error)) Option {
+	return func(o *options) {
+		o.errorHandler = fn
+	}
+}
+
+// Locker obtains locks on redis
+type Locker struct {
+	*redis.Client
+	options
+}
+
+// NewLocker create new locker
+func NewLocker(client *redis.Client, opts ...Option) *Locker {
+	o := options{
+		prefix:        "lock:",
+		retryInterval: 100 * time.Millisecond,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Locker{
+		Client:  client,
+		options: o,
+	}
+}
+
+// Obtain takes the lock of key for ttl, or returns ErrNotObtained when it is held
+func (l *Locker) Obtain(key string, ttl time.Duration) (*Lock, error) {
+	// ttls are set in milliseconds by the scripts
+	if ttl < time.Millisecond {
+		return nil, ErrInvalidTTL
+	}
+
+	lock := &Lock{
+		locker: l,
+		Key:    l.prefix + key,
+		value:  id.NewUUID().String(),
+		ttl:    ttl,
+	}
+
+	token, err := obtainScript.Run(l.Client, []string{lock.Key, lock.Key + ":fence"}, lock.value, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return nil, err
+	}
+
+	if token == 0 {
+		return nil, ErrNotObtained
+	}
+
+	lock.Token = token
+	return lock, nil
+}
+
+// ObtainWait tries to take the lock of key until it succeeds or ctx is done
+func (l *Locker) ObtainWait(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	ticker := time.NewTicker(l.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		lock, err := l.Obtain(key, ttl)
+		if err != ErrNotObtained {
+			return lock, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *Locker) handleError(err error) {
+	if l.errorHandler != nil {
+		l.errorHandler(err)
+	}
+}
+
+// Lock is a held lock
+type Lock struct {
+	locker *Locker
+	// Key is the redis key of the lock
+	Key string
+	// Token increases each time the lock is obtained. Pass it along with writes
+	// guarded by the lock so stores can reject those of a former holder.
+	Token int64
+
+	value string
+	ttl   time.Duration
+}
+
+// Refresh extends the lock by its ttl, or returns ErrNotHeld when it was lost
+func (l *Lock) Refresh() error {
+	n, err := refreshScript.Run(l.locker.Client, []string{l.Key}, l.value, l.ttl.Milliseconds()).Int64()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotHeld
+	}
+
+	return nil
+}
+
+// Release unlocks the lock, or returns ErrNotHeld when it was lost
+func (l *Lock) Release() error {
+	n, err := releaseScript.Run(l.locker.Client, []string{l.Key}, l.value).Int64()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotHeld
+	}
+
+	return nil
+}
+
+// TTL returns the remaining time of the lock, 0 when it was lost
+func (l *Lock) TTL() (time.Duration, error) {
+	value, err := l.locker.Get(l.Key).Result()
+	if err != nil && err != redis.Nil {
+		return 0, err
+	}
+
+	if value != l.value {
+		return 0, nil
+	}
+
+	return l.locker.PTTL(l.Key).Result()
+}
+
+// KeepAlive refreshes the lock every third of its ttl until ctx is done.
+// The returned context is cancelled when the lock is lost, or when refreshes fail until it may have expired.
+func (l *Lock) KeepAlive(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		defer cancel()
+
+		ticker := time.NewTicker(l.ttl / 3)
+		defer ticker.Stop()
+
+		deadline := time.Now().Add(l.ttl)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			err := l.Refresh()
+			if err == nil {
+				deadline = time.Now().Add(l.ttl)
+				continue
+			}
+
+			if err == ErrNotHeld {
+				return
+			}
+
+			l.locker.handleError(err)
+			if !time.Now().Add(l.ttl / 3).Before(deadline) {
+				return
+			}
+		}
+	}()
+
+	return ctx
+}
@@ -0,0 +1,136 @@
+package lk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+func newTestLocker(t *testing.T, opts ...Option) (*Locker, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis.Run() error = %v", err)
+	}
+	t.Cleanup(mr.Close)
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return NewLocker(client, opts...), mr
+}
+
+func TestLock(t *testing.T) {
+	locker, mr := newTestLocker(t)
+
+	first, err := locker.Obtain("job", time.Second)
+	if err != nil || first.Token != 1 {
+		t.Fatalf("Obtain() = %+v, %v, want token 1", first, err)
+	}
+
+	if _, err := locker.Obtain("job", time.Second); err != ErrNotObtained {
+		t.Errorf("Obtain() of a held lock error = %v, want %v", err, ErrNotObtained)
+	}
+
+	if other, err := locker.Obtain("other", time.Second); err != nil || other.Token != 1 {
+		t.Errorf("Obtain(other) = %+v, %v, want token 1", other, err)
+	}
+
+	mr.FastForward(500 * time.Millisecond)
+	if err := first.Refresh(); err != nil {
+		t.Errorf("Refresh() error = %v", err)
+	}
+	if ttl, _ := first.TTL(); ttl != time.Second {
+		t.Errorf("TTL() after Refresh() = %v, want 1s", ttl)
+	}
+
+	// the lock expires and is taken over
+	mr.FastForward(time.Second)
+	second, err := locker.Obtain("job", time.Second)
+	if err != nil || second.Token != 2 {
+		t.Fatalf("Obtain() after expiry = %+v, %v, want token 2", second, err)
+	}
+
+	tests := []struct {
+		name string
+		fn   func() error
+	}{
+		{"Refresh", first.Refresh},
+		{"Release", first.Release},
+	}
+	for _, tt := range tests {
+		if err := tt.fn(); err != ErrNotHeld {
+			t.Errorf("%v() of a lost lock error = %v, want %v", tt.name, err, ErrNotHeld)
+		}
+	}
+
+	if ttl, err := first.TTL(); ttl != 0 || err != nil {
+		t.Errorf("TTL() of a lost lock = %v, %v, want 0", ttl, err)
+	}
+
+	if err := second.Release(); err != nil {
+		t.Errorf("Release() error = %v", err)
+	}
+	if _, err := locker.Obtain("job", time.Second); err != nil {
+		t.Errorf("Obtain() after Release() error = %v", err)
+	}
+}
+
+func TestInvalidTTL(t *testing.T) {
+	locker, _ := newTestLocker(t)
+
+	for _, ttl := range []time.Duration{0, -time.Second, time.Microsecond} {
+		if _, err := locker.Obtain("job", ttl); err != ErrInvalidTTL {
+			t.Errorf("Obtain(%v) error = %v, want %v", ttl, err, ErrInvalidTTL)
+		}
+
+		if _, err := NewElection(locker, "leader", ttl); err != ErrInvalidTTL {
+			t.Errorf("NewElection(%v) error = %v, want %v", ttl, err, ErrInvalidTTL)
+		}
+	}
+}
+
+func TestLocker_ObtainWait(t *testing.T) {
+	locker, _ := newTestLocker(t, WithRetryInterval(5*time.Millisecond))
+
+	held, _ := locker.Obtain("job", time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := locker.ObtainWait(ctx, "job", time.Minute); err != context.DeadlineExceeded {
+		t.Errorf("ObtainWait() of a held lock error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = held.Release()
+	}()
+
+	lock, err := locker.ObtainWait(context.Background(), "job", time.Minute)
+	if err != nil || lock.Token != 2 {
+		t.Errorf("ObtainWait() = %+v, %v, want token 2", lock, err)
+	}
+}
+
+func TestLock_KeepAlive(t *testing.T) {
+	locker, mr := newTestLocker(t)
+
+	lock, _ := locker.Obtain("job", 30*time.Millisecond)
+	ctx := lock.KeepAlive(context.Background())
+
+	// miniredis only expires keys on FastForward, a refresh sets the ttl back
+	mr.FastForward(20 * time.Millisecond)
+	time.Sleep(25 * time.Millisecond)
+	if ttl := mr.TTL(lock.Key); ttl <= 10*time.Millisecond {
+		t.Errorf("PTTL() = %v, want refreshed", ttl)
+	}
+
+	mr.Del(lock.Key)
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Errorf("KeepAlive() context not cancelled after the lock is lost")
+	}
+}
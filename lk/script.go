@@ -0,0 +1,32 @@
+package lk
+
+import (
+	"github.com/go-redis/redis"
+)
+
+// Lua scripts of Lock, a lock is only refreshed or released by the holder of its value
+var (
+	// KEYS[1] lock, KEYS[2] fencing counter, ARGV[1] value, ARGV[2] ttl ms
+	obtainScript = redis.NewScript(`
+if not redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 0
+end
+return redis.call('INCR', KEYS[2])
+`)
+
+	// KEYS[1] lock, ARGV[1] value, ARGV[2] ttl ms
+	refreshScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+`)
+
+	// KEYS[1] lock, ARGV[1] value
+	releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+return redis.call('DEL', KEYS[1])
+`)
+)
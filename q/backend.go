@@ -0,0 +1,232 @@
+package q
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Backend stores encoded messages of a delay queue.
+// DelayQueue keeps them in redis lists, StreamQueue in a redis stream and MemoryQueue in process, all behave the same.
+type Backend interface {
+	// AddsQueue marshals values to json and appends them to the queue
+	AddsQueue(values []interface{}) error
+	// AddsDelay marshals values to json and schedules them at et
+	AddsDelay(values []interface{}, et time.Time) error
+	// PushQueue appends encoded messages to the queue
+	PushQueue(messages ...string) error
+	// PushDelay schedules encoded messages at et
+	PushDelay(et time.Time, messages ...string) error
+	// PushUnique enqueues a message identified by id now or at at, dropping it when id was pushed within dedup
+	PushUnique(id, message string, at time.Time, dedup time.Duration) (bool, error)
+	// Cancel removes a delayed message pushed by PushUnique
+	Cancel(id string) (bool, error)
+	// Reschedule moves a delayed message pushed by PushUnique to at
+	Reschedule(id string, at time.Time) (bool, error)
+	// CheckAndSwap moves due messages from the delay set to the queue, n at a time
+	CheckAndSwap(n int64) (int, error)
+	// Run moves due messages to the queue until ctx is done
+	Run(ctx context.Context) error
+	// FetchQueue pops up to n messages
+	FetchQueue(n int64) ([]string, error)
+	// FetchReliable pops up to n messages and keeps them in flight until Ack or Nack
+	FetchReliable(n int64, visibility time.Duration) ([]Delivery, error)
+	// Ack removes handled deliveries from the in-flight set
+	Ack(handles ...string) error
+	// Nack moves in-flight deliveries back to the queue
+	Nack(handles ...string) (int64, error)
+	// RequeueExpired moves up to n in-flight messages past their visibility deadline back to the queue
+	RequeueExpired(n int64) (int64, error)
+	// InFlight returns the number of fetched messages waiting for Ack
+	InFlight() (int64, error)
+	// Retry moves an in-flight delivery back to the delay set as retried, due after delay
+	Retry(handle, retried string, delay time.Duration) (bool, error)
+	// Bury moves an in-flight delivery to the dead letter queue as dead
+	Bury(handle, dead string) (bool, error)
+	// Revive moves a dead message back to the queue as message
+	Revive(dead, message string) (bool, error)
+	// DeadLetters returns dead messages in range [start, stop], oldest first
+	DeadLetters(start, stop int64) ([]string, error)
+	// DLQSize returns the number of dead messages
+	DLQSize() (int64, error)
+	// PurgeDLQ deletes all dead messages
+	PurgeDLQ() error
+	// Size returns the number of delayed messages
+	Size() (int64, error)
+	// Stats returns the depth and lag of the queue
+	Stats() (Stats, error)
+}
+
+var (
+	_ Backend = (*DelayQueue)(nil)
+	_ Backend = (*MemoryQueue)(nil)
+	_ Backend = (*StreamQueue)(nil)
+)
+
+// Backends of Config
+const (
+	BackendRedis  = "redis"
+	BackendStream = "stream"
+	BackendMemory = "memory"
+)
+
+// Config selects the backend of a queue, so services run on redis in production and in process locally or in tests
+type Config struct {
+	// Backend is BackendRedis, BackendStream or BackendMemory, default BackendRedis
+	Backend string
+	// Alias names the redis keys of the queue
+	Alias string
+	// Group and Consumer name the consumer group of BackendStream and its member
+	Group    string
+	Consumer string
+}
+
+// NewBackend creates the backend selected by cfg, client is not used by BackendMemory
+func NewBackend(client *redis.Client, cfg Config, opts ...Option) (Backend, error) {
+	switch cfg.Backend {
+	case BackendMemory:
+		return NewMemoryQueue(opts...), nil
+	case "", BackendRedis, BackendStream:
+	default:
+		return nil, fmt.Errorf("q: unknown backend %q", cfg.Backend)
+	}
+
+	if client == nil {
+		return nil, fmt.Errorf("q: backend %q needs a redis client", cfg.Backend)
+	}
+
+	if cfg.Backend != BackendStream {
+		return NewDelayQueue(client, cfg.Alias, opts...), nil
+	}
+
+	if cfg.Group == "" || cfg.Consumer == "" {
+		return nil, fmt.Errorf("q: backend %q needs a group and a consumer", cfg.Backend)
+	}
+
+	return NewStreamQueue(client, cfg.Alias, cfg.Group, cfg.Consumer, opts...), nil
+}
+
+type options struct {
+	now          func() time.Time
+	precision    time.Duration
+	maxSleep     time.Duration
+	errorHandler func(error)
+	maxLen       int64
+}
+
+// Option configures a delay queue
+type Option func(*options)
+
+// WithPrecision sets the unit of delay scores, default time.Millisecond.
+// Each precision keeps its own delay set, see delayName. Queues created before WithPrecision scored in seconds
+// under "delay:<alias>": run one scheduler with WithPrecision(time.Second) until its Size is 0 to drain them.
+func WithPrecision(d time.Duration) Option {
+	return func(o *options) {
+		o.precision = d
+	}
+}
+
+// WithMaxSleep caps how long Run sleeps, so items added by other processes are noticed, default 1s
+func WithMaxSleep(d time.Duration) Option {
+	return func(o *options) {
+		o.maxSleep = d
+	}
+}
+
+// WithErrorHandler sets the callback of backend errors in Run
+func WithErrorHandler(fn func(error)) Option {
+	return func(o *options) {
+		o.errorHandler = fn
+	}
+}
+
+// WithMaxLen trims the stream of a StreamQueue to about n entries on each append, default unlimited.
+// Trimmed entries are lost even if they were not consumed.
+func WithMaxLen(n int64) Option {
+	return func(o *options) {
+		o.maxLen = n
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		now:       time.Now,
+		precision: time.Millisecond,
+		maxSleep:  time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.precision <= 0 {
+		o.precision = time.Millisecond
+	}
+
+	return o
+}
+
+// delayName returns the delay set of alias, scores of different precisions never share a set.
+// Second scores keep "delay:<alias>" of queues created before WithPrecision, others get a suffix like "delay:<alias>:1ms".
+func (o *options) delayName(alias string) string {
+	if o.precision == time.Second {
+		return "delay:" + alias
+	}
+
+	return "delay:" + alias + ":" + o.precision.String()
+}
+
+// score converts t to precision units, scores above 2^53 units lose precision
+func (o *options) score(t time.Time) float64 {
+	return float64(t.UnixNano() / int64(o.precision))
+}
+
+func (o *options) fromScore(score float64) time.Time {
+	return time.Unix(0, int64(score)*int64(o.precision))
+}
+
+// sleep returns the wait of Run until due, capped by max sleep
+func (o *options) sleep(due time.Time) time.Duration {
+	wait := due.Sub(o.now())
+	if wait > o.maxSleep {
+		wait = o.maxSleep
+	}
+
+	if wait < 0 {
+		wait = 0
+	}
+
+	return wait
+}
+
+// runLoop calls promote until ctx is done, sleeping for the returned duration or until woken up
+func (o *options) runLoop(ctx context.Context, wake <-chan struct{}, promote func() (time.Duration, error)) error {
+	for {
+		wait, err := promote()
+		if err != nil {
+			if o.errorHandler != nil {
+				o.errorHandler(err)
+			}
+			wait = o.maxSleep
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+func signal(wake chan struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
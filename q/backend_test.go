@@ -0,0 +1,443 @@
+package q
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+type testBackend struct {
+	name    string
+	backend Backend
+	advance func(time.Duration)
+}
+
+// newTestBackends returns the redis and memory backends, each with a fake clock
+func newTestBackends(t *testing.T) []testBackend {
+	dq, mr := newTestQueue(t)
+	mq := NewMemoryQueue()
+	sq, smr := newTestStreamQueue(t)
+	smr.SetTime(time.Unix(1700000000, 0))
+
+	var backends []testBackend
+	for _, b := range []struct {
+		name    string
+		backend Backend
+		opts    *options
+		expire  func(time.Duration)
+	}{
+		{"redis", dq, &dq.options, mr.FastForward},
+		{"memory", mq, &mq.options, func(time.Duration) {}},
+		{"stream", sq, &sq.options, func(d time.Duration) {
+			smr.SetTime(sq.now())
+			smr.FastForward(d)
+		}},
+	} {
+		b := b
+		now := time.Unix(1700000000, 0)
+		b.opts.now = func() time.Time { return now }
+		backends = append(backends, testBackend{
+			name:    b.name,
+			backend: b.backend,
+			advance: func(d time.Duration) {
+				now = now.Add(d)
+				b.expire(d)
+			},
+		})
+	}
+
+	return backends
+}
+
+func TestNewBackend(t *testing.T) {
+	dq, _ := newTestQueue(t)
+
+	tests := []struct {
+		name    string
+		client  *redis.Client
+		cfg     Config
+		want    Backend
+		wantErr bool
+	}{
+		{name: "default", client: dq.Client, cfg: Config{Alias: "test"}, want: &DelayQueue{}},
+		{name: "redis", client: dq.Client, cfg: Config{Backend: BackendRedis, Alias: "test"}, want: &DelayQueue{}},
+		{name: "stream", client: dq.Client, cfg: Config{Backend: BackendStream, Alias: "test", Group: "workers", Consumer: "worker-1"}, want: &StreamQueue{}},
+		{name: "memory", cfg: Config{Backend: BackendMemory}, want: &MemoryQueue{}},
+		{name: "stream without group", client: dq.Client, cfg: Config{Backend: BackendStream, Alias: "test"}, wantErr: true},
+		{name: "redis without client", cfg: Config{Backend: BackendRedis, Alias: "test"}, wantErr: true},
+		{name: "unknown", client: dq.Client, cfg: Config{Backend: "kafka"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewBackend(tt.client, tt.cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewBackend() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if reflect.TypeOf(got) != reflect.TypeOf(tt.want) {
+				t.Errorf("NewBackend() = %T, want %T", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackend_Delay(t *testing.T) {
+	for _, tb := range newTestBackends(t) {
+		t.Run(tb.name, func(t *testing.T) {
+			b := tb.backend
+			start := time.Unix(1700000000, 0)
+
+			_ = b.PushDelay(start.Add(30*time.Second), "c")
+			_ = b.PushDelay(start.Add(10*time.Second), "b", "a")
+			_ = b.PushDelay(start.Add(20*time.Second), "d")
+			_ = b.PushDelay(start.Add(5*time.Second), "d")
+
+			if n, _ := b.Size(); n != 4 {
+				t.Errorf("Size() = %v, want 4 unique members", n)
+			}
+
+			tb.advance(10 * time.Second)
+			if n, err := b.CheckAndSwap(1); n != 3 || err != nil {
+				t.Errorf("CheckAndSwap() = %v, %v, want 3", n, err)
+			}
+
+			got, _ := b.FetchQueue(10)
+			if want := []string{"d", "a", "b"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("FetchQueue() = %v, want %v", got, want)
+			}
+
+			if got, err := b.FetchQueue(10); len(got) != 0 || err != nil {
+				t.Errorf("FetchQueue() on empty queue = %v, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestBackend_Reliable(t *testing.T) {
+	for _, tb := range newTestBackends(t) {
+		t.Run(tb.name, func(t *testing.T) {
+			b := tb.backend
+			_ = b.AddsQueue([]interface{}{"a", "b", "c", "d"})
+
+			fetched, _ := b.FetchReliable(3, time.Second)
+			if got, want := messagesOf(fetched), []string{`"a"`, `"b"`, `"c"`}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("FetchReliable() = %v, want %v", got, want)
+			}
+
+			_ = b.Ack(fetched[0].Handle)
+			if n, _ := b.Nack(fetched[1].Handle, fetched[0].Handle); n != 1 {
+				t.Errorf("Nack() = %v, want 1", n)
+			}
+
+			if n, _ := b.InFlight(); n != 1 {
+				t.Errorf("InFlight() = %v, want 1", n)
+			}
+
+			if n, _ := b.RequeueExpired(10); n != 0 {
+				t.Errorf("RequeueExpired() before deadline = %v, want 0", n)
+			}
+
+			tb.advance(time.Second)
+			if n, _ := b.RequeueExpired(10); n != 1 {
+				t.Errorf("RequeueExpired() after deadline = %v, want 1", n)
+			}
+
+			got, _ := b.FetchQueue(10)
+			if want := []string{`"d"`, `"b"`, `"c"`}; !reflect.DeepEqual(got, want) {
+				t.Errorf("FetchQueue() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestBackend_DuplicateDeliveries(t *testing.T) {
+	for _, tb := range newTestBackends(t) {
+		t.Run(tb.name, func(t *testing.T) {
+			b := tb.backend
+			_ = b.PushQueue("a", "a")
+
+			fetched, _ := b.FetchReliable(2, time.Second)
+			if len(fetched) != 2 || fetched[0].Handle == fetched[1].Handle {
+				t.Fatalf("FetchReliable() = %+v, want 2 deliveries with their own handle", fetched)
+			}
+
+			if n, _ := b.InFlight(); n != 2 {
+				t.Errorf("InFlight() = %v, want 2", n)
+			}
+
+			_ = b.Ack(fetched[0].Handle)
+			if n, _ := b.InFlight(); n != 1 {
+				t.Errorf("InFlight() after one Ack = %v, want 1", n)
+			}
+
+			tb.advance(time.Second)
+			if n, _ := b.RequeueExpired(10); n != 1 {
+				t.Errorf("RequeueExpired() = %v, want the unacknowledged copy", n)
+			}
+
+			if got, _ := b.FetchQueue(10); !reflect.DeepEqual(got, []string{"a"}) {
+				t.Errorf("FetchQueue() = %v, want [a]", got)
+			}
+		})
+	}
+}
+
+func TestBackend_DeliveryCount(t *testing.T) {
+	counts := func(deliveries []Delivery) []int64 {
+		var c []int64
+		for _, d := range deliveries {
+			c = append(c, d.Count)
+		}
+		return c
+	}
+
+	for _, tb := range newTestBackends(t) {
+		t.Run(tb.name, func(t *testing.T) {
+			b := tb.backend
+			_ = b.PushQueue("a", "b")
+
+			fetched, _ := b.FetchReliable(2, time.Second)
+			if got, want := counts(fetched), []int64{1, 1}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("first FetchReliable() counts = %v, want %v", got, want)
+			}
+
+			// a is nacked and b times out, both keep their count
+			_, _ = b.Nack(fetched[0].Handle)
+			tb.advance(time.Second)
+			_, _ = b.RequeueExpired(10)
+
+			fetched, _ = b.FetchReliable(2, time.Second)
+			if got, want := messagesOf(fetched), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("FetchReliable() = %v, want %v", got, want)
+			}
+			if got, want := counts(fetched), []int64{2, 2}; !reflect.DeepEqual(got, want) {
+				t.Errorf("redelivered counts = %v, want %v", got, want)
+			}
+
+			// an acked message starts over when it is queued again
+			_ = b.Ack(fetched[0].Handle)
+			_ = b.PushQueue("a")
+			fetched, _ = b.FetchReliable(1, time.Second)
+			if got, want := counts(fetched), []int64{1}; !reflect.DeepEqual(got, want) {
+				t.Errorf("count after Ack = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestBackend_DeadLetters(t *testing.T) {
+	for _, tb := range newTestBackends(t) {
+		t.Run(tb.name, func(t *testing.T) {
+			b := tb.backend
+			_ = b.PushQueue("a", "b", "c", "d")
+			fetched, _ := b.FetchReliable(4, time.Minute)
+
+			if ok, _ := b.Retry(fetched[0].Handle, "a2", time.Second); !ok {
+				t.Errorf("Retry() = false, want true")
+			}
+			if ok, _ := b.Retry(fetched[0].Handle, "a3", time.Second); ok {
+				t.Errorf("Retry() of a message not in flight = true, want false")
+			}
+
+			for _, d := range fetched[1:] {
+				if ok, _ := b.Bury(d.Handle, "dead-"+d.Message); !ok {
+					t.Errorf("Bury(%v) = false, want true", d.Message)
+				}
+			}
+
+			if got, _ := b.DeadLetters(-2, -1); !reflect.DeepEqual(got, []string{"dead-c", "dead-d"}) {
+				t.Errorf("DeadLetters(-2, -1) = %v", got)
+			}
+			if got, _ := b.DeadLetters(5, 10); len(got) != 0 {
+				t.Errorf("DeadLetters(5, 10) = %v, want empty", got)
+			}
+
+			if ok, _ := b.Revive("dead-c", "c"); !ok {
+				t.Errorf("Revive() = false, want true")
+			}
+			if ok, _ := b.Revive("dead-c", "c"); ok {
+				t.Errorf("Revive() twice = true, want false")
+			}
+
+			tb.advance(time.Second)
+			_, _ = b.CheckAndSwap(10)
+			if got, _ := b.FetchQueue(10); !reflect.DeepEqual(got, []string{"c", "a2"}) {
+				t.Errorf("FetchQueue() = %v, want [c a2]", got)
+			}
+
+			if n, _ := b.DLQSize(); n != 2 {
+				t.Errorf("DLQSize() = %v, want 2", n)
+			}
+			_ = b.PurgeDLQ()
+			if n, _ := b.DLQSize(); n != 0 {
+				t.Errorf("DLQSize() after purge = %v, want 0", n)
+			}
+		})
+	}
+}
+
+func TestBackend_PushUnique(t *testing.T) {
+	for _, tb := range newTestBackends(t) {
+		t.Run(tb.name, func(t *testing.T) {
+			b := tb.backend
+			start := time.Unix(1700000000, 0)
+
+			tests := []struct {
+				id, message string
+				at          time.Time
+				dedup       time.Duration
+				want        bool
+			}{
+				{id: "1", message: "m1", dedup: time.Minute, want: true},
+				{id: "1", message: "m1-again", dedup: time.Minute, want: false},
+				{id: "2", message: "m2", want: true},
+				{id: "2", message: "m2", want: true},
+				{id: "3", message: "m3", at: start.Add(time.Second), dedup: time.Minute, want: true},
+				{id: "3", message: "m3-again", at: start.Add(time.Second), dedup: time.Minute, want: false},
+			}
+			for _, tt := range tests {
+				if got, err := b.PushUnique(tt.id, tt.message, tt.at, tt.dedup); got != tt.want || err != nil {
+					t.Errorf("PushUnique(%v, %v) = %v, %v, want %v", tt.id, tt.message, got, err, tt.want)
+				}
+			}
+
+			if got, _ := b.FetchQueue(10); !reflect.DeepEqual(got, []string{"m1", "m2", "m2"}) {
+				t.Errorf("FetchQueue() = %v, want [m1 m2 m2]", got)
+			}
+
+			tb.advance(time.Minute)
+			if got, _ := b.PushUnique("1", "m1-later", time.Time{}, time.Minute); !got {
+				t.Errorf("PushUnique() after dedup window = false, want true")
+			}
+		})
+	}
+}
+
+func TestBackend_CancelReschedule(t *testing.T) {
+	for _, tb := range newTestBackends(t) {
+		t.Run(tb.name, func(t *testing.T) {
+			b := tb.backend
+			start := time.Unix(1700000000, 0)
+
+			_, _ = b.PushUnique("a", "ma", start.Add(time.Second), 0)
+			_, _ = b.PushUnique("b", "mb", start.Add(2*time.Second), 0)
+			_, _ = b.PushUnique("c", "mc", start.Add(3*time.Second), 0)
+
+			if ok, _ := b.Cancel("b"); !ok {
+				t.Errorf("Cancel(b) = false, want true")
+			}
+			if ok, _ := b.Cancel("b"); ok {
+				t.Errorf("Cancel(b) twice = true, want false")
+			}
+			if ok, _ := b.Cancel("unknown"); ok {
+				t.Errorf("Cancel(unknown) = true, want false")
+			}
+
+			if ok, _ := b.Reschedule("c", start.Add(500*time.Millisecond)); !ok {
+				t.Errorf("Reschedule(c) = false, want true")
+			}
+			if ok, _ := b.Reschedule("b", start); ok {
+				t.Errorf("Reschedule() of a cancelled message = true, want false")
+			}
+
+			tb.advance(time.Second)
+			_, _ = b.CheckAndSwap(10)
+			if got, _ := b.FetchQueue(10); !reflect.DeepEqual(got, []string{"mc", "ma"}) {
+				t.Errorf("FetchQueue() = %v, want [mc ma]", got)
+			}
+
+			if ok, _ := b.Cancel("a"); ok {
+				t.Errorf("Cancel() of a due message = true, want false")
+			}
+			if ok, _ := b.Reschedule("a", start.Add(time.Hour)); ok {
+				t.Errorf("Reschedule() of a due message = true, want false")
+			}
+
+			if n, _ := b.Size(); n != 0 {
+				t.Errorf("Size() = %v, want 0", n)
+			}
+		})
+	}
+}
+
+func messagesOf(deliveries []Delivery) []string {
+	messages := make([]string, len(deliveries))
+	for i := range deliveries {
+		messages[i] = deliveries[i].Message
+	}
+
+	return messages
+}
+
+func TestMemoryQueue_Run(t *testing.T) {
+	q := NewMemoryQueue()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- q.Run(ctx)
+	}()
+
+	_ = q.AddsDelay([]interface{}{"soon"}, time.Now().Add(20*time.Millisecond))
+
+	deadline := time.Now().Add(time.Second)
+	var got []string
+	for len(got) == 0 && time.Now().Before(deadline) {
+		got, _ = q.FetchQueue(10)
+		time.Sleep(time.Millisecond)
+	}
+
+	if len(got) != 1 || got[0] != `"soon"` {
+		t.Errorf("promoted = %v, want [soon]", got)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Run() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestRun_RequeueExpired(t *testing.T) {
+	dq, _ := newTestQueue(t)
+	for _, tt := range []struct {
+		name  string
+		queue interface {
+			Backend
+			Run(ctx context.Context) error
+		}
+	}{
+		{"redis", dq},
+		{"memory", NewMemoryQueue()},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			q := tt.queue
+			_ = q.PushQueue("expiring")
+			if got, _ := q.FetchReliable(1, 20*time.Millisecond); len(got) != 1 {
+				t.Fatalf("FetchReliable() = %v, want 1 delivery", got)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+			go func() {
+				done <- q.Run(ctx)
+			}()
+
+			start := time.Now()
+			var got []string
+			for len(got) == 0 && time.Since(start) < 500*time.Millisecond {
+				got, _ = q.FetchQueue(10)
+				time.Sleep(time.Millisecond)
+			}
+
+			if len(got) != 1 || got[0] != "expiring" {
+				t.Errorf("requeued = %v, want [expiring]", got)
+			}
+
+			cancel()
+			<-done
+		})
+	}
+}
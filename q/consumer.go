@@ -0,0 +1,367 @@
+package q
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sunary/kitchen/wk"
+)
+
+// Consumer fetches values from a queue and runs the handler on a pool.
+// A message is acknowledged when the handler succeeds. When it fails the message is retried
+// through the delay set with backoff, then moved to the dead letter queue after max attempts.
+type Consumer[T any] struct {
+	ctx     context.Context
+	queue   *Queue[T]
+	pool    *wk.Pool
+	handler func(context.Context, T) error
+	consumerOptions
+
+	mu       sync.Mutex
+	started  bool
+	quit     chan struct{}
+	done     chan struct{}
+	inFlight sync.WaitGroup
+	// handles of dispatched tasks the pool has not started yet
+	queued map[*wk.Task]string
+}
+
+type consumerOptions struct {
+	batch        int64
+	visibility   time.Duration
+	pollInterval time.Duration
+	errorHandler func(error)
+	maxAttempts  int
+	baseDelay    time.Duration
+	maxDelay     time.Duration
+}
+
+// ConsumerOption configures a consumer
+type ConsumerOption func(*consumerOptions)
+
+// WithFetchSize sets how many messages are fetched at a time, default 10
+func WithFetchSize(n int64) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.batch = n
+	}
+}
+
+// WithVisibility sets how long a fetched message is hidden before it is delivered again, default 30s
+func WithVisibility(d time.Duration) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.visibility = d
+	}
+}
+
+// WithPollInterval sets the wait after an empty fetch or an error, default 1s
+func WithPollInterval(d time.Duration) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.pollInterval = d
+	}
+}
+
+// WithMaxAttempts sets how many times a message is handled before it is dead, default 5.
+// Deliveries which are never acked, because the handler hangs or the process crashes, count as attempts.
+func WithMaxAttempts(n int) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.maxAttempts = n
+	}
+}
+
+// WithRetryBackoff waits exponentially between attempts, starting from base and capped at max, default 1s to 1m.
+// Delays are computed by wk.Backoff.
+func WithRetryBackoff(base, max time.Duration) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.baseDelay = base
+		o.maxDelay = max
+	}
+}
+
+// WithConsumerErrorHandler sets the callback of redis, decoding and handler errors
+func WithConsumerErrorHandler(fn func(error)) ConsumerOption {
+	return func(o *consumerOptions) {
+		o.errorHandler = fn
+	}
+}
+
+// NewConsumer create new consumer, the pool is started and stopped by the caller.
+// Handlers run with ctx, it is not cancelled by Shutdown.
+func NewConsumer[T any](ctx context.Context, queue *Queue[T], pool *wk.Pool, handler func(context.Context, T) error, opts ...ConsumerOption) *Consumer[T] {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	c := &Consumer[T]{
+		ctx:     ctx,
+		queue:   queue,
+		pool:    pool,
+		handler: handler,
+		consumerOptions: consumerOptions{
+			batch:        10,
+			visibility:   30 * time.Second,
+			pollInterval: time.Second,
+			maxAttempts:  5,
+			baseDelay:    time.Second,
+			maxDelay:     time.Minute,
+		},
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+		queued: make(map[*wk.Task]string),
+	}
+
+	for _, opt := range opts {
+		opt(&c.consumerOptions)
+	}
+
+	if c.batch <= 0 {
+		c.batch = 1
+	}
+
+	if c.maxAttempts <= 0 {
+		c.maxAttempts = 1
+	}
+
+	return c
+}
+
+// Start consuming
+func (c *Consumer[T]) Start() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.started {
+		return
+	}
+	c.started = true
+
+	go c.run()
+}
+
+// Stop consuming and wait running handlers
+func (c *Consumer[T]) Stop() {
+	_ = c.Shutdown(context.Background())
+}
+
+// Shutdown stops fetching and waits for running handlers until ctx is done.
+// Messages of unfinished handlers are delivered again after the visibility timeout.
+// Messages of tasks the pool stops before running are returned to the queue.
+func (c *Consumer[T]) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	started := c.started
+	select {
+	case <-c.quit:
+	default:
+		close(c.quit)
+	}
+	c.mu.Unlock()
+
+	if started {
+		<-c.done
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		c.inFlight.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-c.pool.Done():
+		// tasks left in a stopped pool never run
+		c.releaseQueued()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Consumer[T]) run() {
+	defer close(c.done)
+
+	backend := c.queue.backend
+	for {
+		// due retries wait in the delay set
+		if _, err := backend.CheckAndSwap(c.batch); err != nil {
+			c.report(err)
+		}
+
+		if _, err := backend.RequeueExpired(c.batch); err != nil {
+			c.report(err)
+		}
+
+		deliveries, err := backend.FetchReliable(c.batch, c.visibility)
+		if err != nil {
+			c.report(err)
+		}
+
+		for i, d := range deliveries {
+			if c.stopping() {
+				if _, err := backend.Nack(handlesOf(deliveries[i:])...); err != nil {
+					c.report(err)
+				}
+				return
+			}
+
+			c.dispatch(d)
+		}
+
+		if len(deliveries) > 0 && err == nil {
+			continue
+		}
+
+		timer := time.NewTimer(c.pollInterval)
+		select {
+		case <-c.quit:
+			timer.Stop()
+			return
+		case <-c.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Consumer[T]) stopping() bool {
+	select {
+	case <-c.quit:
+		return true
+	case <-c.ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// dispatch blocks while the pool queue is full
+func (c *Consumer[T]) dispatch(d Delivery) {
+	backend := c.queue.backend
+
+	msg, err := c.queue.decode(d.Message)
+	if err != nil {
+		// a message which can not be decoded would fail forever
+		c.report(fmt.Errorf("q: decode message %q: %v", d.Message, err))
+		if _, err := backend.Bury(d.Handle, d.Message); err != nil {
+			c.report(err)
+		}
+		return
+	}
+
+	// deliveries which were never acked, after a crash or a visibility timeout, count as attempts too
+	msg.Attempt += int(d.Count) - 1
+	if d.Count > 1 && msg.Attempt > c.maxAttempts {
+		msg.Attempt--
+		msg.Error = fmt.Sprintf("q: delivered %d times without ack", d.Count)
+		if err := c.bury(d.Handle, msg.Envelope); err != nil {
+			c.report(err)
+		}
+		return
+	}
+
+	var t *wk.Task
+	t = wk.NewTask(c.ctx, nil, func(ctx context.Context, _ interface{}) error {
+		if !c.claim(t) {
+			return nil
+		}
+		defer c.inFlight.Done()
+
+		if err := c.handler(ctx, msg.Value); err != nil {
+			c.report(err)
+			return c.fail(d.Handle, msg.Envelope, err)
+		}
+
+		return backend.Ack(d.Handle)
+	})
+
+	c.mu.Lock()
+	c.queued[t] = d.Handle
+	c.inFlight.Add(1)
+	c.mu.Unlock()
+
+	if err := c.pool.Do(t); err != nil {
+		c.report(err)
+		if c.claim(t) {
+			c.inFlight.Done()
+		}
+		if _, err := backend.Nack(d.Handle); err != nil {
+			c.report(err)
+		}
+	}
+}
+
+// claim reports whether t was still queued and marks it started
+func (c *Consumer[T]) claim(t *wk.Task) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, ok := c.queued[t]
+	delete(c.queued, t)
+	return ok
+}
+
+// releaseQueued gives up tasks the pool did not start and returns their messages to the queue
+func (c *Consumer[T]) releaseQueued() {
+	c.mu.Lock()
+	handles := make([]string, 0, len(c.queued))
+	for t, handle := range c.queued {
+		handles = append(handles, handle)
+		delete(c.queued, t)
+		c.inFlight.Done()
+	}
+	c.mu.Unlock()
+
+	if len(handles) == 0 {
+		return
+	}
+
+	if _, err := c.queue.backend.Nack(handles...); err != nil {
+		c.report(err)
+	}
+}
+
+// fail schedules the next attempt of a message or buries it
+func (c *Consumer[T]) fail(handle string, env Envelope, cause error) error {
+	backend := c.queue.backend
+
+	env.Error = cause.Error()
+	if env.Attempt >= c.maxAttempts {
+		return c.bury(handle, env)
+	}
+
+	delay := wk.Backoff(c.baseDelay, c.maxDelay, env.Attempt)
+	env.Attempt++
+	env.DueAt = time.Now().Add(delay)
+	retried, err := env.encode()
+	if err != nil {
+		return err
+	}
+
+	_, err = backend.Retry(handle, retried, delay)
+	return err
+}
+
+func (c *Consumer[T]) bury(handle string, env Envelope) error {
+	dead, err := env.encode()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.queue.backend.Bury(handle, dead)
+	return err
+}
+
+func (c *Consumer[T]) report(err error) {
+	if c.errorHandler != nil {
+		c.errorHandler(err)
+	}
+}
@@ -0,0 +1,361 @@
+package q
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sunary/kitchen/wk"
+)
+
+func TestConsumer(t *testing.T) {
+	dq, _ := newTestQueue(t)
+	queue := NewQueue[event](dq, nil)
+
+	pool := wk.NewPool(context.Background(), 4)
+	pool.Start()
+	defer pool.Stop()
+
+	var (
+		mu     sync.Mutex
+		seen   = make(map[int]int)
+		failed = map[int]bool{3: true}
+		errs   []error
+	)
+
+	handler := func(ctx context.Context, ev event) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		seen[ev.ID]++
+		if failed[ev.ID] {
+			delete(failed, ev.ID)
+			return errors.New("temporary")
+		}
+		return nil
+	}
+
+	c := NewConsumer(context.Background(), queue, pool, handler,
+		WithFetchSize(3),
+		WithPollInterval(5*time.Millisecond),
+		WithRetryBackoff(time.Millisecond, time.Millisecond),
+		WithConsumerErrorHandler(func(err error) {
+			mu.Lock()
+			errs = append(errs, err)
+			mu.Unlock()
+		}),
+	)
+	c.Start()
+
+	for i := 1; i <= 10; i++ {
+		if err := queue.Add(event{ID: i}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	_ = dq.PushQueue("not json")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		done := len(seen) == 10 && seen[3] == 2 && len(errs) == 2
+		mu.Unlock()
+		if done || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := c.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i := 1; i <= 10; i++ {
+		want := 1
+		if i == 3 {
+			want = 2
+		}
+		if seen[i] != want {
+			t.Errorf("event %v handled %v times, want %v", i, seen[i], want)
+		}
+	}
+
+	if len(errs) != 2 {
+		t.Errorf("reported errors = %v, want handler and decode errors", errs)
+	}
+
+	if n, _ := dq.InFlight(); n != 0 {
+		t.Errorf("InFlight() = %v after shutdown, want 0", n)
+	}
+}
+
+func TestConsumer_Shutdown(t *testing.T) {
+	dq, _ := newTestQueue(t)
+	queue := NewQueue[int](dq, nil)
+
+	pool := wk.NewPool(context.Background(), 1)
+	pool.Start()
+	defer pool.Stop()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	handler := func(ctx context.Context, v int) error {
+		close(started)
+		<-release
+		close(finished)
+		return nil
+	}
+
+	c := NewConsumer(context.Background(), queue, pool, handler, WithFetchSize(1), WithPollInterval(time.Millisecond))
+	_ = queue.Add(1)
+	c.Start()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	c.Stop()
+
+	select {
+	case <-finished:
+	default:
+		t.Errorf("Stop() returned before the running handler finished")
+	}
+
+	if n, _ := dq.InFlight(); n != 0 {
+		t.Errorf("InFlight() = %v, want 0", n)
+	}
+}
+
+func TestConsumer_DeadLetter(t *testing.T) {
+	dq, mr := newTestQueue(t)
+	queue := NewQueue[event](dq, nil)
+
+	now := time.Now()
+	var mu sync.Mutex
+	dq.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+
+	pool := wk.NewPool(context.Background(), 2)
+	pool.Start()
+	defer pool.Stop()
+
+	attempts := make(chan int, 10)
+	handler := func(ctx context.Context, ev event) error {
+		attempts <- ev.ID
+		return errors.New("permanent")
+	}
+
+	c := NewConsumer(context.Background(), queue, pool, handler,
+		WithMaxAttempts(3),
+		WithRetryBackoff(10*time.Second, time.Minute),
+		WithPollInterval(time.Millisecond),
+	)
+	_ = queue.Add(event{ID: 7})
+	_ = dq.PushQueue("not json")
+	c.Start()
+	defer c.Stop()
+
+	for i := 1; i <= 3; i++ {
+		select {
+		case <-attempts:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("attempt %v not handled", i)
+		}
+
+		if i < 3 {
+			// wait the retry scheduled by backoff then move the clock past it
+			for {
+				if n, _ := dq.Size(); n == 1 {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			scores, _ := mr.ZMembers(dq.DelayName)
+			score, _ := mr.ZScore(dq.DelayName, scores[0])
+			// scores are truncated to the precision of the queue
+			if wait := dq.fromScore(score).Sub(now); wait < 5*time.Second-dq.precision || wait > 2*time.Duration(i)*10*time.Second {
+				t.Errorf("retry %v scheduled after %v", i, wait)
+			}
+
+			mu.Lock()
+			now = now.Add(time.Minute)
+			mu.Unlock()
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if n, _ := dq.DLQSize(); n == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	c.Stop()
+
+	// the undecodable message does not hide the others
+	dead, err := queue.DeadLetters(0, -1)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || !reflect.DeepEqual(decodeErr.Messages, []string{"not json"}) {
+		t.Errorf("DeadLetters() error = %v, want the undecodable message", err)
+	}
+
+	if len(dead) != 1 || dead[0].Value.ID != 7 || dead[0].Attempt != 3 || dead[0].Error != "permanent" {
+		t.Errorf("DeadLetters() = %+v, want the failed message", dead)
+	}
+
+	if n, err := queue.Replay(2); n != 1 || !errors.As(err, &decodeErr) {
+		t.Errorf("Replay(2) = %v, %v, want 1 and the undecodable message", n, err)
+	}
+
+	if raw, _ := dq.DeadLetters(0, -1); !reflect.DeepEqual(raw, []string{"not json"}) {
+		t.Errorf("DLQ after replay = %v, want the undecodable message", raw)
+	}
+
+	if n, _ := dq.InFlight(); n != 0 {
+		t.Errorf("InFlight() = %v, want 0", n)
+	}
+}
+
+func TestConsumer_PoolStopped(t *testing.T) {
+	dq, _ := newTestQueue(t)
+	queue := NewQueue[int](dq, nil)
+
+	pool := wk.NewPool(context.Background(), 1, wk.WithQueueSize(3))
+	pool.Start()
+
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	handler := func(ctx context.Context, v int) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}
+
+	c := NewConsumer(context.Background(), queue, pool, handler, WithFetchSize(3), WithPollInterval(time.Millisecond))
+	_ = queue.Add(1, 2, 3)
+	c.Start()
+	<-started
+
+	// the queued tasks are never executed
+	stopped := make(chan []*wk.Task)
+	go func() { stopped <- pool.StopNow() }()
+	close(release)
+	<-stopped
+
+	done := make(chan struct{})
+	go func() {
+		c.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Stop() hangs after the pool stopped")
+	}
+
+	if len(started) != 0 {
+		t.Errorf("handler called %v more times, want once", len(started))
+	}
+
+	if n, _ := dq.InFlight(); n != 0 {
+		t.Errorf("InFlight() = %v, want 0", n)
+	}
+}
+
+func TestConsumer_NeverAcked(t *testing.T) {
+	mq := NewMemoryQueue()
+	queue := NewQueue[event](mq, nil)
+
+	pool := wk.NewPool(context.Background(), 4)
+	pool.Start()
+	defer pool.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := make(chan int, 10)
+	c := NewConsumer(context.Background(), queue, pool, func(_ context.Context, ev event) error {
+		calls <- ev.ID
+		<-ctx.Done()
+		return ctx.Err()
+	},
+		WithMaxAttempts(3),
+		WithVisibility(10*time.Millisecond),
+		WithPollInterval(time.Millisecond),
+	)
+	_ = queue.Add(event{ID: 7})
+	c.Start()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if n, _ := mq.DLQSize(); n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("message handled %v times and never buried", len(calls))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	c.Stop()
+	if len(calls) != 3 {
+		t.Errorf("handler called %v times, want 3", len(calls))
+	}
+
+	dead, err := queue.DeadLetters(0, -1)
+	if err != nil || len(dead) != 1 || dead[0].Attempt != 3 || dead[0].Error != "q: delivered 4 times without ack" {
+		t.Errorf("DeadLetters() = %+v, %v", dead, err)
+	}
+}
+
+func TestConsumer_Memory(t *testing.T) {
+	queue := NewQueue[event](NewMemoryQueue(), nil)
+
+	pool := wk.NewPool(context.Background(), 2)
+	pool.Start()
+	defer pool.Stop()
+
+	handled := make(chan int, 10)
+	c := NewConsumer(context.Background(), queue, pool, func(ctx context.Context, ev event) error {
+		handled <- ev.ID
+		return nil
+	}, WithPollInterval(time.Millisecond))
+	c.Start()
+
+	_ = queue.Add(event{ID: 1})
+	_ = queue.AddDelay(time.Now().Add(10*time.Millisecond), event{ID: 2})
+
+	for _, want := range []int{1, 2} {
+		select {
+		case id := <-handled:
+			if id != want {
+				t.Errorf("handled %v, want %v", id, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %v not handled", want)
+		}
+	}
+
+	c.Stop()
+	if n, _ := queue.Backend().InFlight(); n != 0 {
+		t.Errorf("InFlight() = %v, want 0", n)
+	}
+}
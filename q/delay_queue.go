@@ -2,7 +2,6 @@ package q
 
 import (
 	"encoding/json"
-	"strconv"
 	"time"
 
 	"github.com/go-redis/redis"
@@ -11,104 +10,126 @@ import (
 // DelayQueue ...
 type DelayQueue struct {
 	*redis.Client
-	QueueName string
-	DelayName string
+	QueueName       string
+	DelayName       string
+	ProcessingName  string
+	DeliveriesName  string
+	DLQName         string
+	DedupPrefix     string
+	ScheduledPrefix string
+
+	options
+	wake chan struct{}
 }
 
 // NewDelayQueue ...
-func NewDelayQueue(redisClient *redis.Client, alias string) *DelayQueue {
+func NewDelayQueue(redisClient *redis.Client, alias string, opts ...Option) *DelayQueue {
+	o := newOptions(opts)
 	return &DelayQueue{
-		redisClient,
-		"queue:" + alias,
-		"delay:" + alias,
+		Client:          redisClient,
+		QueueName:       "queue:" + alias,
+		DelayName:       o.delayName(alias),
+		ProcessingName:  "processing:" + alias,
+		DeliveriesName:  "deliveries:" + alias,
+		DLQName:         "dlq:" + alias,
+		DedupPrefix:     "dedup:" + alias + ":",
+		ScheduledPrefix: "scheduled:" + alias + ":",
+		options:         o,
+		wake:            make(chan struct{}, 1),
 	}
 }
 
-// AddsDelay ...
+// AddsDelay marshals values to json and schedules them at et.
+// Identical values are stored once, see PushUnique to schedule messages by id.
 func (q *DelayQueue) AddsDelay(values []interface{}, et time.Time) error {
-	score := float64(et.Unix())
-	members := make([]redis.Z, len(values))
-	for i := range values {
-		b, _ := json.Marshal(values[i])
-		members[i] = redis.Z{
-			Score:  score,
-			Member: b,
-		}
+	messages, err := marshalJSON(values)
+	if err != nil {
+		return err
 	}
 
-	return q.Client.ZAdd(q.DelayName, members...).Err()
+	return q.PushDelay(et, messages...)
 }
 
-// AddsQueue ...
+// AddsQueue marshals values to json and appends them to the queue
 func (q *DelayQueue) AddsQueue(values []interface{}) error {
-	members := make([]interface{}, len(values))
-	for i := range values {
-		members[i], _ = json.Marshal(values[i])
+	messages, err := marshalJSON(values)
+	if err != nil {
+		return err
 	}
 
-	return q.Client.RPush(q.QueueName, members...).Err()
+	return q.PushQueue(messages...)
 }
 
-// CheckAndSwap ...
-func (q *DelayQueue) CheckAndSwap(n int64) (int, error) {
-	count := 0
-	for {
-		rangeBy := redis.ZRangeBy{
-			Min:    "-inf",
-			Max:    strconv.Itoa(int(time.Now().Unix())),
-			Offset: 0,
-			Count:  n,
-		}
-		results, err := q.Client.ZRangeByScore(q.DelayName, rangeBy).Result()
-		if err != nil || len(results) == 0 {
-			return count, err
-		}
+// PushDelay schedules encoded messages at et
+func (q *DelayQueue) PushDelay(et time.Time, messages ...string) error {
+	if len(messages) == 0 {
+		return nil
+	}
 
-		err = q.swapQueue(results)
-		if err != nil {
-			return count, err
+	score := q.score(et)
+	members := make([]redis.Z, len(messages))
+	for i := range messages {
+		members[i] = redis.Z{
+			Score:  score,
+			Member: messages[i],
 		}
+	}
 
-		count += len(results)
+	if err := q.Client.ZAdd(q.DelayName, members...).Err(); err != nil {
+		return err
 	}
+
+	signal(q.wake)
+	return nil
 }
 
-func (q *DelayQueue) swapQueue(members []string) error {
-	pipe := q.Client.Pipeline()
-	pipe.ZRemRangeByRank(q.DelayName, 0, int64(len(members)))
+// PushQueue appends encoded messages to the queue
+func (q *DelayQueue) PushQueue(messages ...string) error {
+	if len(messages) == 0 {
+		return nil
+	}
 
-	mis := make([]interface{}, len(members))
-	for i := range members {
-		mis[i] = members[i]
+	return q.Client.RPush(q.QueueName, toInterfaces(messages)...).Err()
+}
+
+// CheckAndSwap moves due messages from the delay set to the queue, n at a time.
+// Each batch is moved atomically by score, so it is safe to run on many replicas.
+func (q *DelayQueue) CheckAndSwap(n int64) (int, error) {
+	if n <= 0 {
+		n = 1
 	}
 
-	pipe.RPush(q.QueueName, mis...)
-	_, err := pipe.Exec()
-	return err
+	count := 0
+	for {
+		moved, err := promoteScript.Run(q.Client, []string{q.DelayName, q.QueueName}, q.score(q.now()), n).Int64()
+		count += int(moved)
+		if err != nil || moved < n {
+			return count, err
+		}
+	}
 }
 
-// FetchQueue ...
+// FetchQueue pops up to n messages atomically, so two consumers never get the same message.
+// Messages are lost if the consumer crashes before handling them, see FetchReliable.
 func (q *DelayQueue) FetchQueue(n int64) ([]string, error) {
-	results, err := q.Client.LRange(q.QueueName, 0, n-1).Result()
-	if err != nil || len(results) == 0 {
-		return nil, err
-	}
+	return toStrings(fetchScript.Run(q.Client, []string{q.QueueName, q.DeliveriesName}, n).Result())
+}
 
-	err = q.Client.LTrim(q.QueueName, int64(len(results)), -1).Err()
-	if err != nil {
-		members := make([]interface{}, len(results))
-		for i := range results {
-			members[i] = results[i]
+func marshalJSON(values []interface{}) ([]string, error) {
+	messages := make([]string, len(values))
+	for i := range values {
+		b, err := json.Marshal(values[i])
+		if err != nil {
+			return nil, err
 		}
 
-		q.Client.RPush(q.QueueName, members...)
-		return nil, err
+		messages[i] = string(b)
 	}
 
-	return results, nil
+	return messages, nil
 }
 
-// Size ...
+// Size returns the number of delayed messages, see Stats
 func (q DelayQueue) Size() (int64, error) {
 	return q.Client.ZCount(q.DelayName, "-inf", "+inf").Result()
 }
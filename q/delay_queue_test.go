@@ -0,0 +1,268 @@
+package q
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+func newTestQueue(t *testing.T, opts ...Option) (*DelayQueue, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis.Run() error = %v", err)
+	}
+	t.Cleanup(mr.Close)
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return NewDelayQueue(client, "test", opts...), mr
+}
+
+func TestDelayQueue_FetchQueue(t *testing.T) {
+	q, _ := newTestQueue(t)
+
+	if err := q.AddsQueue([]interface{}{1, 2, 3}); err != nil {
+		t.Fatalf("AddsQueue() error = %v", err)
+	}
+
+	got, err := q.FetchQueue(2)
+	if err != nil || len(got) != 2 || got[0] != "1" || got[1] != "2" {
+		t.Fatalf("FetchQueue() = %v, %v, want [1 2]", got, err)
+	}
+
+	got, _ = q.FetchQueue(2)
+	if len(got) != 1 || got[0] != "3" {
+		t.Errorf("FetchQueue() = %v, want [3]", got)
+	}
+
+	got, err = q.FetchQueue(2)
+	if err != nil || len(got) != 0 {
+		t.Errorf("FetchQueue() on empty queue = %v, %v", got, err)
+	}
+}
+
+func TestDelayQueue_FetchReliable(t *testing.T) {
+	q, _ := newTestQueue(t)
+	now := time.Now()
+	q.now = func() time.Time { return now }
+
+	_ = q.AddsQueue([]interface{}{"a", "b", "c"})
+
+	got, err := q.FetchReliable(3, time.Minute)
+	if err != nil || len(got) != 3 {
+		t.Fatalf("FetchReliable() = %v, %v", got, err)
+	}
+
+	if n, _ := q.InFlight(); n != 3 {
+		t.Errorf("InFlight() = %v, want 3", n)
+	}
+
+	if err := q.Ack(got[0].Handle); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+
+	if n, err := q.Nack(got[1].Handle); err != nil || n != 1 {
+		t.Fatalf("Nack() = %v, %v, want 1", n, err)
+	}
+
+	requeued, _ := q.FetchQueue(10)
+	if len(requeued) != 1 || requeued[0] != got[1].Message {
+		t.Errorf("FetchQueue() after Nack = %v, want [%v]", requeued, got[1])
+	}
+
+	if n, _ := q.RequeueExpired(10); n != 0 {
+		t.Errorf("RequeueExpired() before deadline = %v, want 0", n)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if n, err := q.RequeueExpired(10); err != nil || n != 1 {
+		t.Fatalf("RequeueExpired() = %v, %v, want 1", n, err)
+	}
+
+	expired, _ := q.FetchQueue(10)
+	if len(expired) != 1 || expired[0] != got[2].Message {
+		t.Errorf("FetchQueue() after RequeueExpired = %v, want [%v]", expired, got[2])
+	}
+
+	if n, _ := q.InFlight(); n != 0 {
+		t.Errorf("InFlight() = %v, want 0", n)
+	}
+
+	if n, _ := q.Nack(got[0].Handle); n != 0 {
+		t.Errorf("Nack() of acknowledged message requeued %v", n)
+	}
+}
+
+func TestDelayQueue_CheckAndSwap(t *testing.T) {
+	q, _ := newTestQueue(t)
+	now := time.Now()
+	q.now = func() time.Time { return now }
+
+	_ = q.AddsDelay([]interface{}{"due-1", "due-2", "due-3"}, now.Add(-time.Minute))
+	_ = q.AddsDelay([]interface{}{"future"}, now.Add(time.Hour))
+
+	n, err := q.CheckAndSwap(2)
+	if err != nil || n != 3 {
+		t.Fatalf("CheckAndSwap() = %v, %v, want 3", n, err)
+	}
+
+	if size, _ := q.Size(); size != 1 {
+		t.Errorf("Size() = %v, want the future message left", size)
+	}
+
+	got, _ := q.FetchQueue(10)
+	if len(got) != 3 {
+		t.Errorf("FetchQueue() = %v, want 3 due messages", got)
+	}
+}
+
+func TestDelayQueue_CheckAndSwapConcurrent(t *testing.T) {
+	q, _ := newTestQueue(t)
+	now := time.Now()
+	q.now = func() time.Time { return now }
+
+	values := make([]interface{}, 500)
+	for i := range values {
+		values[i] = i
+	}
+	_ = q.AddsDelay(values, now.Add(-time.Second))
+
+	var (
+		wg    sync.WaitGroup
+		total int64
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			n, err := q.CheckAndSwap(7)
+			if err != nil {
+				t.Errorf("CheckAndSwap() error = %v", err)
+			}
+			atomic.AddInt64(&total, int64(n))
+		}()
+	}
+	wg.Wait()
+
+	if total != 500 {
+		t.Errorf("CheckAndSwap() moved %v messages, want 500", total)
+	}
+
+	got, _ := q.FetchQueue(1000)
+	seen := make(map[string]bool)
+	for _, m := range got {
+		if seen[m] {
+			t.Errorf("message %v promoted twice", m)
+		}
+		seen[m] = true
+	}
+
+	if len(seen) != 500 {
+		t.Errorf("queue has %v distinct messages, want 500", len(seen))
+	}
+}
+
+func TestDelayQueue_DelayName(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{name: "default", want: "delay:test:1ms"},
+		{name: "second", opts: []Option{WithPrecision(time.Second)}, want: "delay:test"},
+		{name: "microsecond", opts: []Option{WithPrecision(time.Microsecond)}, want: "delay:test:1µs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewDelayQueue(nil, "test", tt.opts...).DelayName; got != tt.want {
+				t.Errorf("DelayName = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDelayQueue_Precision(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		delay     time.Duration
+		elapsed   time.Duration
+		wantMoved int
+	}{
+		{name: "millisecond not due", delay: 300 * time.Millisecond, elapsed: 299 * time.Millisecond, wantMoved: 0},
+		{name: "millisecond due", delay: 300 * time.Millisecond, elapsed: 300 * time.Millisecond, wantMoved: 1},
+		{name: "second rounds down", opts: []Option{WithPrecision(time.Second)}, delay: 1500 * time.Millisecond, elapsed: time.Second, wantMoved: 1},
+		{name: "second not due", opts: []Option{WithPrecision(time.Second)}, delay: 2 * time.Second, elapsed: 1999 * time.Millisecond, wantMoved: 0},
+		{name: "microsecond", opts: []Option{WithPrecision(time.Microsecond)}, delay: 10 * time.Microsecond, elapsed: 9 * time.Microsecond, wantMoved: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr, err := miniredis.Run()
+			if err != nil {
+				t.Fatalf("miniredis.Run() error = %v", err)
+			}
+			defer mr.Close()
+
+			client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			defer client.Close()
+
+			q := NewDelayQueue(client, "test", tt.opts...)
+			now := time.Unix(1700000000, 0)
+			q.now = func() time.Time { return now }
+
+			_ = q.AddsDelay([]interface{}{"v"}, now.Add(tt.delay))
+
+			now = now.Add(tt.elapsed)
+			if n, err := q.CheckAndSwap(10); err != nil || n != tt.wantMoved {
+				t.Errorf("CheckAndSwap() = %v, %v, want %v", n, err, tt.wantMoved)
+			}
+		})
+	}
+}
+
+func TestDelayQueue_Run(t *testing.T) {
+	q, _ := newTestQueue(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- q.Run(ctx)
+	}()
+
+	start := time.Now()
+	_ = q.AddsDelay([]interface{}{"late"}, start.Add(80*time.Millisecond))
+	_ = q.AddsDelay([]interface{}{"soon"}, start.Add(20*time.Millisecond))
+
+	var got []string
+	for len(got) < 2 && time.Since(start) < time.Second {
+		messages, _ := q.FetchQueue(10)
+		for _, m := range messages {
+			got = append(got, m)
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("%v promoted after %v", m, elapsed)
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if len(got) != 2 || got[0] != `"soon"` || got[1] != `"late"` {
+		t.Errorf("promoted = %v, want [soon late]", got)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Run() error = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Run() did not return after cancel")
+	}
+}
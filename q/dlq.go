@@ -0,0 +1,45 @@
+package q
+
+import (
+	"time"
+)
+
+// Retry moves an in-flight delivery back to the delay set as retried, due after delay.
+// It returns false when the delivery is not in flight anymore.
+func (q *DelayQueue) Retry(handle, retried string, delay time.Duration) (bool, error) {
+	moved, err := retryScript.Run(q.Client, []string{q.ProcessingName, q.DelayName, q.DeliveriesName}, handle, retried, q.score(q.now().Add(delay))).Int64()
+	if moved == 1 {
+		signal(q.wake)
+	}
+
+	return moved == 1, err
+}
+
+// Bury moves an in-flight delivery to the dead letter queue as dead.
+// It returns false when the delivery is not in flight anymore.
+func (q *DelayQueue) Bury(handle, dead string) (bool, error) {
+	moved, err := buryScript.Run(q.Client, []string{q.ProcessingName, q.DLQName, q.DeliveriesName}, handle, dead).Int64()
+	return moved == 1, err
+}
+
+// Revive moves a dead message back to the queue as message.
+// It returns false when the dead message was already revived or purged.
+func (q *DelayQueue) Revive(dead, message string) (bool, error) {
+	moved, err := reviveScript.Run(q.Client, []string{q.DLQName, q.QueueName}, dead, message).Int64()
+	return moved == 1, err
+}
+
+// DeadLetters returns dead messages in range [start, stop], oldest first
+func (q *DelayQueue) DeadLetters(start, stop int64) ([]string, error) {
+	return q.Client.LRange(q.DLQName, start, stop).Result()
+}
+
+// DLQSize returns the number of dead messages
+func (q *DelayQueue) DLQSize() (int64, error) {
+	return q.Client.LLen(q.DLQName).Result()
+}
+
+// PurgeDLQ deletes all dead messages
+func (q *DelayQueue) PurgeDLQ() error {
+	return q.Client.Del(q.DLQName).Err()
+}
@@ -0,0 +1,45 @@
+package q
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/sunary/kitchen/id"
+)
+
+// Envelope wraps an encoded value of a typed queue with its delivery state
+type Envelope struct {
+	ID         string    `json:"id"`
+	Attempt    int       `json:"attempt"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	DueAt      time.Time `json:"due_at"`
+	Error      string    `json:"error,omitempty"`
+	Body       []byte    `json:"body"`
+}
+
+// Message is a decoded value with its envelope
+type Message[T any] struct {
+	Envelope
+	Value T
+}
+
+func newEnvelope(body []byte, now, due time.Time) Envelope {
+	return Envelope{
+		ID:         id.NewUUID().String(),
+		Attempt:    1,
+		EnqueuedAt: now,
+		DueAt:      due,
+		Body:       body,
+	}
+}
+
+func (env Envelope) encode() (string, error) {
+	b, err := json.Marshal(env)
+	return string(b), err
+}
+
+func decodeEnvelope(message string) (Envelope, error) {
+	var env Envelope
+	err := json.Unmarshal([]byte(message), &env)
+	return env, err
+}
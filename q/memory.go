@@ -0,0 +1,417 @@
+package q
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryQueue keeps messages in process with the semantics of DelayQueue.
+// It is meant for tests and local runs, messages are lost when the process exits.
+type MemoryQueue struct {
+	options
+	wake chan struct{}
+
+	mu         sync.Mutex
+	queue      []string
+	delay      *zset
+	processing *zset
+	seq        int64
+	deliveries map[string]int64
+	dlq        []string
+	dedup      map[string]expiring
+	scheduled  map[string]expiring
+	pushes     int
+}
+
+// NewMemoryQueue create new in-process queue
+func NewMemoryQueue(opts ...Option) *MemoryQueue {
+	return &MemoryQueue{
+		options:    newOptions(opts),
+		wake:       make(chan struct{}, 1),
+		delay:      newZset(),
+		processing: newZset(),
+		deliveries: make(map[string]int64),
+		dedup:      make(map[string]expiring),
+		scheduled:  make(map[string]expiring),
+	}
+}
+
+// AddsDelay marshals values to json and schedules them at et
+func (q *MemoryQueue) AddsDelay(values []interface{}, et time.Time) error {
+	messages, err := marshalJSON(values)
+	if err != nil {
+		return err
+	}
+
+	return q.PushDelay(et, messages...)
+}
+
+// AddsQueue marshals values to json and appends them to the queue
+func (q *MemoryQueue) AddsQueue(values []interface{}) error {
+	messages, err := marshalJSON(values)
+	if err != nil {
+		return err
+	}
+
+	return q.PushQueue(messages...)
+}
+
+// PushDelay schedules encoded messages at et
+func (q *MemoryQueue) PushDelay(et time.Time, messages ...string) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	score := q.score(et)
+
+	q.mu.Lock()
+	for _, m := range messages {
+		q.delay.add(m, score)
+	}
+	q.mu.Unlock()
+
+	signal(q.wake)
+	return nil
+}
+
+// PushQueue appends encoded messages to the queue
+func (q *MemoryQueue) PushQueue(messages ...string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.queue = append(q.queue, messages...)
+	return nil
+}
+
+// CheckAndSwap moves due messages from the delay set to the queue
+func (q *MemoryQueue) CheckAndSwap(n int64) (int, error) {
+	max := q.score(q.now())
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	count := 0
+	for q.delay.Len() > 0 && q.delay.min().score <= max {
+		q.queue = append(q.queue, q.delay.popMin().member)
+		count++
+	}
+
+	return count, nil
+}
+
+// Run moves due messages to the queue and requeues expired in-flight ones until ctx is done,
+// sleeping until the next one is due
+func (q *MemoryQueue) Run(ctx context.Context) error {
+	return q.runLoop(ctx, q.wake, q.promote)
+}
+
+func (q *MemoryQueue) promote() (time.Duration, error) {
+	_, _ = q.CheckAndSwap(runBatch)
+	_, _ = q.RequeueExpired(runBatch)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	wait := q.maxSleep
+	if q.delay.Len() > 0 {
+		wait = q.sleep(q.fromScore(q.delay.min().score))
+	}
+
+	if q.processing.Len() > 0 {
+		if d := q.sleep(time.UnixMilli(int64(q.processing.min().score))); d < wait {
+			wait = d
+		}
+	}
+
+	return wait, nil
+}
+
+// FetchQueue pops up to n messages
+func (q *MemoryQueue) FetchQueue(n int64) ([]string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := q.pop(n)
+	for _, m := range items {
+		delete(q.deliveries, m)
+	}
+
+	return items, nil
+}
+
+// FetchReliable pops up to n messages and keeps them in flight until Ack or Nack
+func (q *MemoryQueue) FetchReliable(n int64, visibility time.Duration) ([]Delivery, error) {
+	deadline := float64(toMillis(q.now().Add(visibility)))
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := q.pop(n)
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	deliveries := make([]Delivery, len(items))
+	for i, m := range items {
+		q.seq++
+		q.deliveries[m]++
+		deliveries[i] = Delivery{Handle: newHandle(q.seq, m), Message: m, Count: q.deliveries[m]}
+		q.processing.add(deliveries[i].Handle, deadline)
+	}
+
+	return deliveries, nil
+}
+
+// pop requires q.mu held, n follows the LRANGE 0 n-1 of DelayQueue
+func (q *MemoryQueue) pop(n int64) []string {
+	items := lrange(q.queue, 0, n-1)
+	if len(items) == 0 {
+		return nil
+	}
+
+	q.queue = q.queue[len(items):]
+	return items
+}
+
+// Ack removes handled deliveries from the in-flight set
+func (q *MemoryQueue) Ack(handles ...string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, h := range handles {
+		if q.processing.remove(h) {
+			delete(q.deliveries, handleMessage(h))
+		}
+	}
+
+	return nil
+}
+
+// Nack moves in-flight deliveries back to the queue, it returns the number of requeued messages
+func (q *MemoryQueue) Nack(handles ...string) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var count int64
+	for _, h := range handles {
+		if q.processing.remove(h) {
+			q.queue = append(q.queue, handleMessage(h))
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// RequeueExpired moves up to n in-flight messages past their visibility deadline back to the queue
+func (q *MemoryQueue) RequeueExpired(n int64) (int64, error) {
+	now := float64(toMillis(q.now()))
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var count int64
+	for count < n && q.processing.Len() > 0 && q.processing.min().score <= now {
+		q.queue = append(q.queue, handleMessage(q.processing.popMin().member))
+		count++
+	}
+
+	return count, nil
+}
+
+// InFlight returns the number of fetched messages waiting for Ack
+func (q *MemoryQueue) InFlight() (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return int64(q.processing.Len()), nil
+}
+
+// Retry moves an in-flight delivery back to the delay set as retried, due after delay
+func (q *MemoryQueue) Retry(handle, retried string, delay time.Duration) (bool, error) {
+	score := q.score(q.now().Add(delay))
+
+	q.mu.Lock()
+	if !q.processing.remove(handle) {
+		q.mu.Unlock()
+		return false, nil
+	}
+
+	delete(q.deliveries, handleMessage(handle))
+	q.delay.add(retried, score)
+	q.mu.Unlock()
+
+	signal(q.wake)
+	return true, nil
+}
+
+// Bury moves an in-flight delivery to the dead letter queue as dead
+func (q *MemoryQueue) Bury(handle, dead string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.processing.remove(handle) {
+		return false, nil
+	}
+
+	delete(q.deliveries, handleMessage(handle))
+	q.dlq = append(q.dlq, dead)
+	return true, nil
+}
+
+// Revive moves a dead message back to the queue as message
+func (q *MemoryQueue) Revive(dead, message string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := range q.dlq {
+		if q.dlq[i] == dead {
+			q.dlq = append(q.dlq[:i:i], q.dlq[i+1:]...)
+			q.queue = append(q.queue, message)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// DeadLetters returns dead messages in range [start, stop], oldest first
+func (q *MemoryQueue) DeadLetters(start, stop int64) ([]string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return lrange(q.dlq, start, stop), nil
+}
+
+// DLQSize returns the number of dead messages
+func (q *MemoryQueue) DLQSize() (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return int64(len(q.dlq)), nil
+}
+
+// PurgeDLQ deletes all dead messages
+func (q *MemoryQueue) PurgeDLQ() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.dlq = nil
+	return nil
+}
+
+// Size returns the number of delayed messages
+func (q *MemoryQueue) Size() (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return int64(q.delay.Len()), nil
+}
+
+// lrange copies list[start:stop+1] with the index rules of redis LRANGE
+func lrange(list []string, start, stop int64) []string {
+	n := int64(len(list))
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+
+	if start > stop {
+		return []string{}
+	}
+
+	return append([]string{}, list[start:stop+1]...)
+}
+
+// zset is a heap of unique members ordered by score then member, like a redis sorted set
+type zset struct {
+	items    []*zmember
+	byMember map[string]*zmember
+}
+
+type zmember struct {
+	member string
+	score  float64
+	index  int
+}
+
+func newZset() *zset {
+	return &zset{
+		byMember: make(map[string]*zmember),
+	}
+}
+
+func (z *zset) Len() int { return len(z.items) }
+
+func (z *zset) Less(i, j int) bool {
+	if z.items[i].score != z.items[j].score {
+		return z.items[i].score < z.items[j].score
+	}
+
+	return z.items[i].member < z.items[j].member
+}
+
+func (z *zset) Swap(i, j int) {
+	z.items[i], z.items[j] = z.items[j], z.items[i]
+	z.items[i].index = i
+	z.items[j].index = j
+}
+
+func (z *zset) Push(x interface{}) {
+	m := x.(*zmember)
+	m.index = len(z.items)
+	z.items = append(z.items, m)
+	z.byMember[m.member] = m
+}
+
+func (z *zset) Pop() interface{} {
+	m := z.items[len(z.items)-1]
+	z.items[len(z.items)-1] = nil
+	z.items = z.items[:len(z.items)-1]
+	delete(z.byMember, m.member)
+	return m
+}
+
+// add inserts member or updates its score
+func (z *zset) add(member string, score float64) {
+	if m, ok := z.byMember[member]; ok {
+		m.score = score
+		heap.Fix(z, m.index)
+		return
+	}
+
+	heap.Push(z, &zmember{member: member, score: score})
+}
+
+func (z *zset) has(member string) bool {
+	_, ok := z.byMember[member]
+	return ok
+}
+
+func (z *zset) remove(member string) bool {
+	m, ok := z.byMember[member]
+	if !ok {
+		return false
+	}
+
+	heap.Remove(z, m.index)
+	return true
+}
+
+func (z *zset) min() *zmember {
+	return z.items[0]
+}
+
+func (z *zset) popMin() *zmember {
+	return heap.Pop(z).(*zmember)
+}
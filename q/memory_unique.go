@@ -0,0 +1,114 @@
+package q
+
+import (
+	"time"
+)
+
+// sweepEvery is the number of PushUnique calls between two sweeps of expired ids
+const sweepEvery = 1024
+
+type expiring struct {
+	member string
+	expiry time.Time
+}
+
+// PushUnique enqueues a message identified by id, see DelayQueue.PushUnique
+func (q *MemoryQueue) PushUnique(id, message string, at time.Time, dedup time.Duration) (bool, error) {
+	now := q.now()
+	score := q.score(at)
+
+	q.mu.Lock()
+	q.pushes++
+	if q.pushes%sweepEvery == 0 {
+		q.sweep(now)
+	}
+
+	if dedup > 0 {
+		if e, ok := q.dedup[id]; ok && now.Before(e.expiry) {
+			q.mu.Unlock()
+			return false, nil
+		}
+
+		q.dedup[id] = expiring{expiry: now.Add(dedup)}
+	}
+
+	if at.IsZero() {
+		q.queue = append(q.queue, message)
+		q.mu.Unlock()
+		return true, nil
+	}
+
+	q.delay.add(message, score)
+	q.scheduled[id] = expiring{member: message, expiry: q.indexExpiry(at)}
+	q.mu.Unlock()
+
+	signal(q.wake)
+	return true, nil
+}
+
+// Cancel removes a delayed message pushed by PushUnique, see DelayQueue.Cancel
+func (q *MemoryQueue) Cancel(id string) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e, ok := q.lookup(id)
+	if !ok {
+		return false, nil
+	}
+
+	delete(q.scheduled, id)
+	return q.delay.remove(e.member), nil
+}
+
+// Reschedule moves a delayed message pushed by PushUnique to at, see DelayQueue.Reschedule
+func (q *MemoryQueue) Reschedule(id string, at time.Time) (bool, error) {
+	score := q.score(at)
+
+	q.mu.Lock()
+	e, ok := q.lookup(id)
+	if !ok || !q.delay.has(e.member) {
+		q.mu.Unlock()
+		return false, nil
+	}
+
+	q.delay.add(e.member, score)
+	q.scheduled[id] = expiring{member: e.member, expiry: q.indexExpiry(at)}
+	q.mu.Unlock()
+
+	signal(q.wake)
+	return true, nil
+}
+
+// lookup requires q.mu held
+func (q *MemoryQueue) lookup(id string) (expiring, bool) {
+	e, ok := q.scheduled[id]
+	if !ok || !q.now().Before(e.expiry) {
+		return expiring{}, false
+	}
+
+	return e, true
+}
+
+func (q *MemoryQueue) indexExpiry(at time.Time) time.Time {
+	now := q.now()
+	if at.Before(now) {
+		at = now
+	}
+
+	return at.Add(scheduledRetention)
+}
+
+// sweep requires q.mu held
+func (q *MemoryQueue) sweep(now time.Time) {
+	for id, e := range q.dedup {
+		if !now.Before(e.expiry) {
+			delete(q.dedup, id)
+		}
+	}
+
+	for id, e := range q.scheduled {
+		if !now.Before(e.expiry) {
+			delete(q.scheduled, id)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package q
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrDuplicate is returned by Put when a message with the same id was put within the dedup window
+var ErrDuplicate = errors.New("q: duplicate message")
+
+// DecodeError is returned along with the decoded messages when some of them can not be decoded
+type DecodeError struct {
+	Messages []string // raw messages which were skipped
+	Err      error    // error of the first one
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("q: skipped %d undecodable messages, first %q: %v", len(e.Messages), e.Messages[0], e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *DecodeError) add(message string, err error) {
+	if e.Err == nil {
+		e.Err = err
+	}
+	e.Messages = append(e.Messages, message)
+}
+
+func (e *DecodeError) orNil() error {
+	if len(e.Messages) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Queue is a typed view of a Backend.
+// Values are encoded by a codec and wrapped in an Envelope tracking their attempts.
+type Queue[T any] struct {
+	backend Backend
+	codec   Codec
+}
+
+// NewQueue create new typed queue on a backend, nil codec means JSONCodec
+func NewQueue[T any](backend Backend, codec Codec) *Queue[T] {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+
+	return &Queue[T]{
+		backend: backend,
+		codec:   codec,
+	}
+}
+
+// Backend returns the underlying queue
+func (q *Queue[T]) Backend() Backend {
+	return q.backend
+}
+
+// Add appends values to the queue
+func (q *Queue[T]) Add(values ...T) error {
+	messages, err := q.encode(values, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	return q.backend.PushQueue(messages...)
+}
+
+// AddDelay schedules values at et
+func (q *Queue[T]) AddDelay(et time.Time, values ...T) error {
+	messages, err := q.encode(values, et)
+	if err != nil {
+		return err
+	}
+
+	return q.backend.PushDelay(et, messages...)
+}
+
+type putOptions struct {
+	id    string
+	at    time.Time
+	dedup time.Duration
+}
+
+// PutOption configures a message put in a queue
+type PutOption func(*putOptions)
+
+// WithID sets the message id, default a random UUID
+func WithID(id string) PutOption {
+	return func(o *putOptions) {
+		o.id = id
+	}
+}
+
+// WithDueAt delays the message until at
+func WithDueAt(at time.Time) PutOption {
+	return func(o *putOptions) {
+		o.at = at
+	}
+}
+
+// WithDelay delays the message by d
+func WithDelay(d time.Duration) PutOption {
+	return func(o *putOptions) {
+		o.at = time.Now().Add(d)
+	}
+}
+
+// WithDedup drops the message when one with the same id was put within window.
+// Use it with WithID as an idempotency key.
+func WithDedup(window time.Duration) PutOption {
+	return func(o *putOptions) {
+		o.dedup = window
+	}
+}
+
+// Put enqueues a value and returns its id, see WithID, WithDueAt and WithDedup.
+// It returns ErrDuplicate when the message is dropped by dedup.
+func (q *Queue[T]) Put(value T, opts ...PutOption) (string, error) {
+	o := putOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	b, err := q.codec.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	env := newEnvelope(b, time.Now(), o.at)
+	if o.id != "" {
+		env.ID = o.id
+	}
+
+	message, err := env.encode()
+	if err != nil {
+		return "", err
+	}
+
+	ok, err := q.backend.PushUnique(env.ID, message, o.at, o.dedup)
+	if err != nil {
+		return "", err
+	}
+
+	if !ok {
+		return env.ID, ErrDuplicate
+	}
+
+	return env.ID, nil
+}
+
+// Cancel removes a delayed message put with Put, it returns false when the message is already due or unknown
+func (q *Queue[T]) Cancel(id string) (bool, error) {
+	return q.backend.Cancel(id)
+}
+
+// Reschedule moves a delayed message put with Put to at, it returns false when the message is already due or unknown
+func (q *Queue[T]) Reschedule(id string, at time.Time) (bool, error) {
+	return q.backend.Reschedule(id, at)
+}
+
+// Fetch pops up to n values, see FetchQueue.
+// Messages failing to decode are dropped and reported by the returned error.
+func (q *Queue[T]) Fetch(n int64) ([]T, error) {
+	messages, err := q.backend.FetchQueue(n)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]T, 0, len(messages))
+	var decodeErr error
+	for _, m := range messages {
+		msg, err := q.decode(m)
+		if err != nil {
+			decodeErr = err
+			continue
+		}
+
+		values = append(values, msg.Value)
+	}
+
+	return values, decodeErr
+}
+
+// DeadLetters returns messages in the dead letter queue in range [start, stop], oldest first.
+// Messages which can not be decoded are skipped and returned raw in a *DecodeError.
+func (q *Queue[T]) DeadLetters(start, stop int64) ([]Message[T], error) {
+	dead, err := q.backend.DeadLetters(start, stop)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]Message[T], 0, len(dead))
+	decodeErr := &DecodeError{}
+	for _, m := range dead {
+		msg, err := q.decode(m)
+		if err != nil {
+			decodeErr.add(m, err)
+			continue
+		}
+
+		messages = append(messages, msg)
+	}
+
+	return messages, decodeErr.orNil()
+}
+
+// Replay moves up to n oldest dead messages back to the queue with their attempts reset.
+// Messages which can not be decoded stay in the dead letter queue and are reported in a *DecodeError.
+func (q *Queue[T]) Replay(n int64) (int, error) {
+	if n <= 0 {
+		return 0, nil
+	}
+
+	dead, err := q.backend.DeadLetters(0, n-1)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	decodeErr := &DecodeError{}
+	for _, m := range dead {
+		env, err := decodeEnvelope(m)
+		if err != nil {
+			decodeErr.add(m, err)
+			continue
+		}
+
+		env.Attempt = 1
+		env.Error = ""
+		env.DueAt = time.Now()
+		message, err := env.encode()
+		if err != nil {
+			return count, err
+		}
+
+		ok, err := q.backend.Revive(m, message)
+		if err != nil {
+			return count, err
+		}
+
+		if ok {
+			count++
+		}
+	}
+
+	return count, decodeErr.orNil()
+}
+
+// PurgeDLQ deletes all dead messages
+func (q *Queue[T]) PurgeDLQ() error {
+	return q.backend.PurgeDLQ()
+}
+
+func (q *Queue[T]) encode(values []T, due time.Time) ([]string, error) {
+	now := time.Now()
+	messages := make([]string, len(values))
+	for i := range values {
+		b, err := q.codec.Marshal(values[i])
+		if err != nil {
+			return nil, err
+		}
+
+		if messages[i], err = newEnvelope(b, now, due).encode(); err != nil {
+			return nil, err
+		}
+	}
+
+	return messages, nil
+}
+
+func (q *Queue[T]) decode(message string) (Message[T], error) {
+	msg := Message[T]{}
+
+	var err error
+	if msg.Envelope, err = decodeEnvelope(message); err != nil {
+		return msg, err
+	}
+
+	err = q.codec.Unmarshal(msg.Body, &msg.Value)
+	return msg, err
+}
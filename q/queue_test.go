@@ -0,0 +1,183 @@
+package q
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type event struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestQueue_JSON(t *testing.T) {
+	dq, _ := newTestQueue(t)
+	queue := NewQueue[event](dq, nil)
+
+	want := []event{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}}
+	if err := queue.Add(want...); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	got, err := queue.Fetch(10)
+	if err != nil || len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Fetch() = %v, %v, want %v", got, err, want)
+	}
+}
+
+func TestQueue_Proto(t *testing.T) {
+	dq, _ := newTestQueue(t)
+	queue := NewQueue[*wrapperspb.StringValue](dq, ProtoCodec{})
+
+	if err := queue.Add(wrapperspb.String("hello")); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	got, err := queue.Fetch(10)
+	if err != nil || len(got) != 1 || got[0].GetValue() != "hello" {
+		t.Errorf("Fetch() = %v, %v, want [hello]", got, err)
+	}
+}
+
+func TestQueue_MarshalError(t *testing.T) {
+	dq, _ := newTestQueue(t)
+
+	tests := []struct {
+		name string
+		add  func() error
+	}{
+		{
+			name: "json",
+			add: func() error {
+				return NewQueue[func()](dq, nil).Add(func() {})
+			},
+		},
+		{
+			name: "proto",
+			add: func() error {
+				return NewQueue[string](dq, ProtoCodec{}).AddDelay(time.Now(), "not a message")
+			},
+		},
+		{
+			name: "untyped",
+			add: func() error {
+				return dq.AddsQueue([]interface{}{make(chan int)})
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.add(); err == nil {
+				t.Errorf("add() error = nil, want marshal error")
+			}
+		})
+	}
+
+	if n, _ := dq.Client.LLen(dq.QueueName).Result(); n != 0 {
+		t.Errorf("queue length = %v after failed adds, want 0", n)
+	}
+}
+
+func TestQueue_DecodeError(t *testing.T) {
+	dq, _ := newTestQueue(t)
+	queue := NewQueue[event](dq, nil)
+	_ = queue.Add(event{ID: 1})
+	_ = dq.PushQueue(`not json`)
+	_ = queue.Add(event{ID: 3})
+
+	got, err := queue.Fetch(10)
+	if err == nil || len(got) != 2 || got[0].ID != 1 || got[1].ID != 3 {
+		t.Errorf("Fetch() = %v, %v, want 2 values and an error", got, err)
+	}
+}
+
+func TestQueue_DLQ(t *testing.T) {
+	dq, _ := newTestQueue(t)
+	queue := NewQueue[event](dq, nil)
+
+	_ = queue.Add(event{ID: 1}, event{ID: 2}, event{ID: 3})
+	deliveries, _ := dq.FetchReliable(3, time.Minute)
+	for i, d := range deliveries {
+		env, _ := decodeEnvelope(d.Message)
+		env.Attempt = 5
+		env.Error = "failed"
+		dead, _ := env.encode()
+		if ok, err := dq.Bury(d.Handle, dead); !ok || err != nil {
+			t.Fatalf("Bury(%v) = %v, %v", i, ok, err)
+		}
+	}
+
+	if ok, _ := dq.Bury(deliveries[0].Handle, deliveries[0].Message); ok {
+		t.Errorf("Bury() of a message not in flight = true, want false")
+	}
+
+	dead, err := queue.DeadLetters(0, -1)
+	if err != nil || len(dead) != 3 {
+		t.Fatalf("DeadLetters() = %v, %v, want 3 messages", dead, err)
+	}
+
+	for i, msg := range dead {
+		if msg.Value.ID != i+1 || msg.Attempt != 5 || msg.Error != "failed" || msg.ID == "" || msg.EnqueuedAt.IsZero() {
+			t.Errorf("DeadLetters()[%v] = %+v", i, msg)
+		}
+	}
+
+	if n, err := queue.Replay(2); n != 2 || err != nil {
+		t.Fatalf("Replay(2) = %v, %v, want 2", n, err)
+	}
+
+	if n, _ := dq.DLQSize(); n != 1 {
+		t.Errorf("DLQSize() = %v after replay, want 1", n)
+	}
+
+	replayed, _ := dq.FetchQueue(10)
+	for i, m := range replayed {
+		msg, _ := queue.decode(m)
+		if msg.Value.ID != i+1 || msg.Attempt != 1 || msg.Error != "" || msg.ID != dead[i].ID {
+			t.Errorf("replayed message %v = %+v", i, msg)
+		}
+	}
+
+	if err := queue.PurgeDLQ(); err != nil {
+		t.Fatalf("PurgeDLQ() error = %v", err)
+	}
+
+	if n, _ := dq.DLQSize(); n != 0 {
+		t.Errorf("DLQSize() = %v after purge, want 0", n)
+	}
+}
+
+func TestQueue_Put(t *testing.T) {
+	queue := NewQueue[event](NewMemoryQueue(), nil)
+
+	id, err := queue.Put(event{ID: 1}, WithID("order-1"), WithDedup(time.Minute))
+	if err != nil || id != "order-1" {
+		t.Fatalf("Put() = %v, %v, want order-1", id, err)
+	}
+
+	if _, err := queue.Put(event{ID: 1}, WithID("order-1"), WithDedup(time.Minute)); err != ErrDuplicate {
+		t.Errorf("Put() duplicate error = %v, want %v", err, ErrDuplicate)
+	}
+
+	id, err = queue.Put(event{ID: 2}, WithDelay(time.Hour))
+	if err != nil || id == "" {
+		t.Fatalf("Put() delayed = %v, %v", id, err)
+	}
+
+	if ok, err := queue.Reschedule(id, time.Now().Add(-time.Second)); !ok || err != nil {
+		t.Fatalf("Reschedule() = %v, %v, want true", ok, err)
+	}
+
+	_, _ = queue.Backend().CheckAndSwap(10)
+	got, err := queue.Fetch(10)
+	if err != nil || len(got) != 2 || got[0].ID != 1 || got[1].ID != 2 {
+		t.Errorf("Fetch() = %v, %v, want events 1 and 2", got, err)
+	}
+
+	id, _ = queue.Put(event{ID: 3}, WithDueAt(time.Now().Add(time.Hour)))
+	if ok, _ := queue.Cancel(id); !ok {
+		t.Errorf("Cancel() = false, want true")
+	}
+}
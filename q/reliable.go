@@ -0,0 +1,127 @@
+package q
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Delivery is a message fetched by FetchReliable.
+// Each delivery has its own Handle, so identical messages in flight are acknowledged separately.
+type Delivery struct {
+	// Handle identifies the delivery in Ack, Nack, Retry and Bury
+	Handle  string
+	Message string
+	// Count is how many times the message was fetched since it was queued, including this delivery.
+	// Nack and RequeueExpired keep it, identical messages queued at the same time share it.
+	Count int64
+}
+
+// FetchReliable pops up to n messages and keeps them in the processing set until Ack or Nack.
+// Messages not acknowledged within visibility are requeued by RequeueExpired.
+func (q *DelayQueue) FetchReliable(n int64, visibility time.Duration) ([]Delivery, error) {
+	deadline := toMillis(q.now().Add(visibility))
+	keys := []string{q.QueueName, q.ProcessingName, q.ProcessingName + ":seq", q.DeliveriesName}
+	return toDeliveries(fetchReliableScript.Run(q.Client, keys, n, deadline).Result())
+}
+
+// Ack removes handled deliveries from the processing set
+func (q *DelayQueue) Ack(handles ...string) error {
+	if len(handles) == 0 {
+		return nil
+	}
+
+	return ackScript.Run(q.Client, []string{q.ProcessingName, q.DeliveriesName}, toInterfaces(handles)...).Err()
+}
+
+// Nack moves in-flight deliveries back to the queue, it returns the number of requeued messages
+func (q *DelayQueue) Nack(handles ...string) (int64, error) {
+	if len(handles) == 0 {
+		return 0, nil
+	}
+
+	return nackScript.Run(q.Client, []string{q.ProcessingName, q.QueueName}, toInterfaces(handles)...).Int64()
+}
+
+// RequeueExpired moves up to n in-flight messages past their visibility deadline back to the queue
+func (q *DelayQueue) RequeueExpired(n int64) (int64, error) {
+	return requeueScript.Run(q.Client, []string{q.ProcessingName, q.QueueName}, toMillis(q.now()), n).Int64()
+}
+
+// InFlight returns the number of fetched messages waiting for Ack
+func (q *DelayQueue) InFlight() (int64, error) {
+	return q.Client.ZCard(q.ProcessingName).Result()
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func toStrings(v interface{}, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	items, _ := v.([]interface{})
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	results := make([]string, len(items))
+	for i := range items {
+		results[i], _ = items[i].(string)
+	}
+
+	return results, nil
+}
+
+// toDeliveries parses the handle, message and count triples returned by fetchReliableScript
+func toDeliveries(v interface{}, err error) ([]Delivery, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	items, _ := v.([]interface{})
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	deliveries := make([]Delivery, len(items)/3)
+	for i := range deliveries {
+		d := &deliveries[i]
+		d.Handle, _ = items[3*i].(string)
+		d.Message, _ = items[3*i+1].(string)
+		d.Count, _ = items[3*i+2].(int64)
+	}
+
+	return deliveries, nil
+}
+
+// handlesOf returns the handles of deliveries
+func handlesOf(deliveries []Delivery) []string {
+	handles := make([]string, len(deliveries))
+	for i := range deliveries {
+		handles[i] = deliveries[i].Handle
+	}
+
+	return handles
+}
+
+// newHandle prefixes message with the sequence number of its delivery, see luaHandleMessage
+func newHandle(seq int64, message string) string {
+	return strconv.FormatInt(seq, 10) + ":" + message
+}
+
+// handleMessage returns the message of a handle made by newHandle
+func handleMessage(handle string) string {
+	return handle[strings.IndexByte(handle, ':')+1:]
+}
+
+func toInterfaces(values []string) []interface{} {
+	members := make([]interface{}, len(values))
+	for i := range values {
+		members[i] = values[i]
+	}
+
+	return members
+}
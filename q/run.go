@@ -0,0 +1,51 @@
+package q
+
+import (
+	"context"
+	"time"
+)
+
+// runBatch is the number of messages promoted by each script call in Run
+const runBatch = 100
+
+// Run moves due messages to the queue and requeues expired in-flight ones until ctx is done,
+// sleeping until the next one is due.
+// Messages scheduled by this DelayQueue wake it up, those of other processes are noticed within max sleep.
+// It is safe to run on many replicas, use lk.Election to run it on one only.
+func (q *DelayQueue) Run(ctx context.Context) error {
+	return q.runLoop(ctx, q.wake, q.promote)
+}
+
+// promote moves due and expired messages and returns the duration until the next one
+func (q *DelayQueue) promote() (time.Duration, error) {
+	if _, err := q.CheckAndSwap(runBatch); err != nil {
+		return 0, err
+	}
+
+	if _, err := q.RequeueExpired(runBatch); err != nil {
+		return 0, err
+	}
+
+	wait := q.maxSleep
+	next, err := q.Client.ZRangeWithScores(q.DelayName, 0, 0).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(next) > 0 {
+		wait = q.sleep(q.fromScore(next[0].Score))
+	}
+
+	expiring, err := q.Client.ZRangeWithScores(q.ProcessingName, 0, 0).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(expiring) > 0 {
+		if d := q.sleep(time.UnixMilli(int64(expiring[0].Score))); d < wait {
+			wait = d
+		}
+	}
+
+	return wait, nil
+}
@@ -0,0 +1,154 @@
+package q
+
+import (
+	"github.com/go-redis/redis"
+)
+
+// luaHandleMessage returns the message of a processing member, members are handles made of the delivery
+// sequence number and the message
+const luaHandleMessage = `
+local function handleMessage(member)
+	return string.match(member, '^%d+:(.*)$')
+end
+`
+
+// Lua scripts run atomically in redis, so concurrent producers, consumers and schedulers never interleave
+var (
+	// KEYS[1] delay, KEYS[2] queue, ARGV[1] max score, ARGV[2] count
+	promoteScript = redis.NewScript(`
+local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, item in ipairs(items) do
+	redis.call('ZREM', KEYS[1], item)
+	redis.call('RPUSH', KEYS[2], item)
+end
+return #items
+`)
+
+	// KEYS[1] queue, KEYS[2] deliveries, ARGV[1] count
+	fetchScript = redis.NewScript(`
+local items = redis.call('LRANGE', KEYS[1], 0, tonumber(ARGV[1]) - 1)
+if #items > 0 then
+	redis.call('LTRIM', KEYS[1], #items, -1)
+	for _, item in ipairs(items) do
+		redis.call('HDEL', KEYS[2], item)
+	end
+end
+return items
+`)
+
+	// KEYS[1] queue, KEYS[2] processing, KEYS[3] delivery sequence, KEYS[4] deliveries,
+	// ARGV[1] count, ARGV[2] visibility deadline, returns triples of handle, message and delivery count
+	fetchReliableScript = redis.NewScript(`
+local items = redis.call('LRANGE', KEYS[1], 0, tonumber(ARGV[1]) - 1)
+local deliveries = {}
+if #items > 0 then
+	redis.call('LTRIM', KEYS[1], #items, -1)
+	local seq = redis.call('INCRBY', KEYS[3], #items) - #items
+	for i, item in ipairs(items) do
+		local handle = (seq + i) .. ':' .. item
+		redis.call('ZADD', KEYS[2], ARGV[2], handle)
+		deliveries[#deliveries + 1] = handle
+		deliveries[#deliveries + 1] = item
+		deliveries[#deliveries + 1] = redis.call('HINCRBY', KEYS[4], item, 1)
+	end
+end
+return deliveries
+`)
+
+	// KEYS[1] processing, KEYS[2] deliveries, ARGV handles
+	ackScript = redis.NewScript(luaHandleMessage + `
+for _, handle in ipairs(ARGV) do
+	if redis.call('ZREM', KEYS[1], handle) == 1 then
+		redis.call('HDEL', KEYS[2], handleMessage(handle))
+	end
+end
+return 0
+`)
+
+	// KEYS[1] processing, KEYS[2] queue, ARGV handles
+	nackScript = redis.NewScript(luaHandleMessage + `
+local count = 0
+for _, handle in ipairs(ARGV) do
+	if redis.call('ZREM', KEYS[1], handle) == 1 then
+		redis.call('RPUSH', KEYS[2], handleMessage(handle))
+		count = count + 1
+	end
+end
+return count
+`)
+
+	// KEYS[1] processing, KEYS[2] queue, ARGV[1] now, ARGV[2] count
+	requeueScript = redis.NewScript(luaHandleMessage + `
+local handles = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, handle in ipairs(handles) do
+	redis.call('ZREM', KEYS[1], handle)
+	redis.call('RPUSH', KEYS[2], handleMessage(handle))
+end
+return #handles
+`)
+
+	// KEYS[1] processing, KEYS[2] delay, KEYS[3] deliveries, ARGV[1] handle, ARGV[2] retried message, ARGV[3] score
+	retryScript = redis.NewScript(luaHandleMessage + `
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[3], handleMessage(ARGV[1]))
+redis.call('ZADD', KEYS[2], ARGV[3], ARGV[2])
+return 1
+`)
+
+	// KEYS[1] processing, KEYS[2] dlq, KEYS[3] deliveries, ARGV[1] handle, ARGV[2] dead message
+	buryScript = redis.NewScript(luaHandleMessage + `
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('HDEL', KEYS[3], handleMessage(ARGV[1]))
+redis.call('RPUSH', KEYS[2], ARGV[2])
+return 1
+`)
+
+	// KEYS[1] dlq, KEYS[2] queue, ARGV[1] dead message, ARGV[2] message
+	reviveScript = redis.NewScript(`
+if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then
+	return 0
+end
+redis.call('RPUSH', KEYS[2], ARGV[2])
+return 1
+`)
+
+	// KEYS[1] dedup, KEYS[2] queue, KEYS[3] delay, KEYS[4] index,
+	// ARGV[1] message, ARGV[2] dedup window ms, ARGV[3] score or empty to enqueue now, ARGV[4] index ttl ms
+	pushUniqueScript = redis.NewScript(`
+if tonumber(ARGV[2]) > 0 and not redis.call('SET', KEYS[1], 1, 'NX', 'PX', ARGV[2]) then
+	return 0
+end
+if ARGV[3] == '' then
+	redis.call('RPUSH', KEYS[2], ARGV[1])
+else
+	redis.call('ZADD', KEYS[3], ARGV[3], ARGV[1])
+	redis.call('SET', KEYS[4], ARGV[1], 'PX', ARGV[4])
+end
+return 1
+`)
+
+	// KEYS[1] index, KEYS[2] delay
+	cancelScript = redis.NewScript(`
+local member = redis.call('GET', KEYS[1])
+if not member then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+return redis.call('ZREM', KEYS[2], member)
+`)
+
+	// KEYS[1] index, KEYS[2] delay, ARGV[1] score, ARGV[2] index ttl ms
+	rescheduleScript = redis.NewScript(`
+local member = redis.call('GET', KEYS[1])
+if not member or not redis.call('ZSCORE', KEYS[2], member) then
+	return 0
+end
+redis.call('ZADD', KEYS[2], ARGV[1], member)
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return 1
+`)
+)
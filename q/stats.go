@@ -0,0 +1,156 @@
+package q
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/sunary/kitchen/l"
+)
+
+// ErrInvalidInterval is returned by WatchStats when interval is not positive
+var ErrInvalidInterval = errors.New("q: interval must be positive")
+
+// Stats describes the depth and lag of a queue
+type Stats struct {
+	// Delayed is the number of messages waiting for their due time
+	Delayed int64
+	// Ready is the number of messages waiting for a consumer
+	Ready int64
+	// InFlight is the number of fetched messages waiting for Ack
+	InFlight int64
+	// Dead is the number of messages in the dead letter queue
+	Dead int64
+	// OldestReady is how long the next ready message waits for a consumer.
+	// It is known for messages put by Queue only, zero otherwise.
+	// A rescheduled message counts from the due time it was put with.
+	OldestReady time.Duration
+	// NextDue is the due time of the next delayed message, zero when there is none
+	NextDue time.Time
+}
+
+// Stats returns a consistent snapshot of the queue
+func (q *DelayQueue) Stats() (Stats, error) {
+	var (
+		delayed, inFlight *redis.IntCmd
+		ready, dead       *redis.IntCmd
+		next              *redis.ZSliceCmd
+		head              *redis.StringCmd
+	)
+
+	_, err := q.Client.TxPipelined(func(pipe redis.Pipeliner) error {
+		delayed = pipe.ZCard(q.DelayName)
+		ready = pipe.LLen(q.QueueName)
+		inFlight = pipe.ZCard(q.ProcessingName)
+		dead = pipe.LLen(q.DLQName)
+		next = pipe.ZRangeWithScores(q.DelayName, 0, 0)
+		head = pipe.LIndex(q.QueueName, 0)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return Stats{}, err
+	}
+
+	s := Stats{
+		Delayed:     delayed.Val(),
+		Ready:       ready.Val(),
+		InFlight:    inFlight.Val(),
+		Dead:        dead.Val(),
+		OldestReady: readyAge(head.Val(), q.now()),
+	}
+
+	if z := next.Val(); len(z) > 0 {
+		s.NextDue = q.fromScore(z[0].Score)
+	}
+
+	return s, nil
+}
+
+// Stats returns a snapshot of the queue
+func (q *MemoryQueue) Stats() (Stats, error) {
+	now := q.now()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	s := Stats{
+		Delayed:  int64(q.delay.Len()),
+		Ready:    int64(len(q.queue)),
+		InFlight: int64(q.processing.Len()),
+		Dead:     int64(len(q.dlq)),
+	}
+
+	if len(q.queue) > 0 {
+		s.OldestReady = readyAge(q.queue[0], now)
+	}
+
+	if q.delay.Len() > 0 {
+		s.NextDue = q.fromScore(q.delay.min().score)
+	}
+
+	return s, nil
+}
+
+// readyAge returns how long an enveloped message has been ready at now
+func readyAge(message string, now time.Time) time.Duration {
+	if message == "" {
+		return 0
+	}
+
+	env, err := decodeEnvelope(message)
+	if err != nil {
+		return 0
+	}
+
+	readyAt := env.EnqueuedAt
+	if env.DueAt.After(readyAt) {
+		readyAt = env.DueAt
+	}
+
+	if readyAt.IsZero() || now.Before(readyAt) {
+		return 0
+	}
+
+	return now.Sub(readyAt)
+}
+
+// WatchStats reports stats of backend to hook every interval until ctx is done
+func WatchStats(ctx context.Context, backend Backend, interval time.Duration, hook func(Stats, error)) error {
+	if interval <= 0 {
+		return ErrInvalidInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		hook(backend.Stats())
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// LogStats returns a WatchStats hook logging stats of the queue name
+func LogStats(logger l.Logger, name string) func(Stats, error) {
+	return func(s Stats, err error) {
+		if err != nil {
+			logger.Error("Queue stats", l.String("queue", name), l.Error(err))
+			return
+		}
+
+		logger.Info("Queue stats",
+			l.String("queue", name),
+			l.Int64("delayed", s.Delayed),
+			l.Int64("ready", s.Ready),
+			l.Int64("in_flight", s.InFlight),
+			l.Int64("dead", s.Dead),
+			l.Duration("oldest_ready", s.OldestReady),
+			l.Time("next_due", s.NextDue),
+		)
+	}
+}
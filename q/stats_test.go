@@ -0,0 +1,107 @@
+package q
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sunary/kitchen/l"
+	"go.uber.org/zap"
+)
+
+func TestBackend_Stats(t *testing.T) {
+	for _, tb := range newTestBackends(t) {
+		t.Run(tb.name, func(t *testing.T) {
+			b := tb.backend
+			start := time.Unix(1700000000, 0)
+
+			if s, err := b.Stats(); err != nil || s != (Stats{}) {
+				t.Errorf("Stats() of an empty queue = %+v, %v", s, err)
+			}
+
+			first, _ := newEnvelope([]byte(`1`), start.Add(-time.Minute), start.Add(-2*time.Second)).encode()
+			second, _ := newEnvelope([]byte(`2`), start, time.Time{}).encode()
+			_ = b.PushQueue("in-flight", "dead")
+			fetched, _ := b.FetchReliable(2, time.Minute)
+			_, _ = b.Bury(fetched[1].Handle, "dead")
+
+			_ = b.PushQueue(first, second, "raw")
+			_ = b.PushDelay(start.Add(time.Hour), "later")
+			_ = b.PushDelay(start.Add(time.Minute), "soon")
+
+			tb.advance(3 * time.Second)
+			s, err := b.Stats()
+			want := Stats{
+				Delayed:     2,
+				Ready:       3,
+				InFlight:    1,
+				Dead:        1,
+				OldestReady: 5 * time.Second,
+				NextDue:     start.Add(time.Minute),
+			}
+			if err != nil || s.Delayed != want.Delayed || s.Ready != want.Ready || s.Dead != want.Dead || s.InFlight != want.InFlight {
+				t.Errorf("Stats() = %+v, %v, want %+v", s, err, want)
+			}
+
+			if s.OldestReady != want.OldestReady || !s.NextDue.Equal(want.NextDue) {
+				t.Errorf("Stats() lag = %v next %v, want %v next %v", s.OldestReady, s.NextDue, want.OldestReady, want.NextDue)
+			}
+		})
+	}
+}
+
+func TestReadyAge(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	encode := func(enqueued, due time.Time) string {
+		m, _ := newEnvelope(nil, enqueued, due).encode()
+		return m
+	}
+
+	tests := []struct {
+		name    string
+		message string
+		want    time.Duration
+	}{
+		{name: "empty", message: "", want: 0},
+		{name: "not an envelope", message: `"raw"`, want: 0},
+		{name: "enqueued", message: encode(now.Add(-time.Second), time.Time{}), want: time.Second},
+		{name: "delayed", message: encode(now.Add(-time.Hour), now.Add(-time.Minute)), want: time.Minute},
+		{name: "clock skew", message: encode(now.Add(time.Second), time.Time{}), want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readyAge(tt.message, now); got != tt.want {
+				t.Errorf("readyAge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatchStats(t *testing.T) {
+	q := NewMemoryQueue()
+	_ = q.PushQueue("a", "b")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	logStats := LogStats(l.Logger{Logger: zap.NewNop()}, "test")
+
+	reports := 0
+	err := WatchStats(ctx, q, time.Millisecond, func(s Stats, err error) {
+		logStats(s, err)
+		if s.Ready != 2 || err != nil {
+			t.Errorf("hook Stats = %+v, %v", s, err)
+		}
+
+		reports++
+		if reports == 3 {
+			cancel()
+		}
+	})
+
+	if err != context.Canceled || reports != 3 {
+		t.Errorf("WatchStats() = %v after %v reports, want %v after 3", err, reports, context.Canceled)
+	}
+
+	if err := WatchStats(context.Background(), q, 0, logStats); err != ErrInvalidInterval {
+		t.Errorf("WatchStats() with zero interval = %v, want %v", err, ErrInvalidInterval)
+	}
+}
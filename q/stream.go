@@ -0,0 +1,522 @@
+package q
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// StreamQueue is a Backend on a redis stream read by a consumer group.
+// Delayed and dead messages are kept like DelayQueue, ready messages are stream entries.
+// Acknowledged entries are deleted, so the stream only holds ready and in-flight messages.
+type StreamQueue struct {
+	*redis.Client
+	StreamName      string
+	DelayName       string
+	DLQName         string
+	DedupPrefix     string
+	ScheduledPrefix string
+	Group           string
+	Consumer        string
+
+	options
+	wake chan struct{}
+
+	mu         sync.Mutex
+	grouped    bool
+	visibility time.Duration
+}
+
+// NewStreamQueue create new stream queue, consumers of the same group share the messages
+func NewStreamQueue(redisClient *redis.Client, alias, group, consumer string, opts ...Option) *StreamQueue {
+	o := newOptions(opts)
+	return &StreamQueue{
+		Client:          redisClient,
+		StreamName:      "stream:" + alias,
+		DelayName:       o.delayName(alias),
+		DLQName:         "dlq:" + alias,
+		DedupPrefix:     "dedup:" + alias + ":",
+		ScheduledPrefix: "scheduled:" + alias + ":",
+		Group:           group,
+		Consumer:        consumer,
+		options:         o,
+		wake:            make(chan struct{}, 1),
+		visibility:      30 * time.Second,
+	}
+}
+
+// AddsDelay marshals values to json and schedules them at et
+func (q *StreamQueue) AddsDelay(values []interface{}, et time.Time) error {
+	messages, err := marshalJSON(values)
+	if err != nil {
+		return err
+	}
+
+	return q.PushDelay(et, messages...)
+}
+
+// AddsQueue marshals values to json and appends them to the stream
+func (q *StreamQueue) AddsQueue(values []interface{}) error {
+	messages, err := marshalJSON(values)
+	if err != nil {
+		return err
+	}
+
+	return q.PushQueue(messages...)
+}
+
+// PushDelay schedules encoded messages at et
+func (q *StreamQueue) PushDelay(et time.Time, messages ...string) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	score := q.score(et)
+	members := make([]redis.Z, len(messages))
+	for i := range messages {
+		members[i] = redis.Z{
+			Score:  score,
+			Member: messages[i],
+		}
+	}
+
+	if err := q.Client.ZAdd(q.DelayName, members...).Err(); err != nil {
+		return err
+	}
+
+	signal(q.wake)
+	return nil
+}
+
+// PushQueue appends encoded messages to the stream
+func (q *StreamQueue) PushQueue(messages ...string) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	args := append([]interface{}{q.maxLen}, toInterfaces(messages)...)
+	return streamAddScript.Run(q.Client, []string{q.StreamName}, args...).Err()
+}
+
+// PushUnique enqueues a message identified by id, see DelayQueue.PushUnique
+func (q *StreamQueue) PushUnique(id, message string, at time.Time, dedup time.Duration) (bool, error) {
+	score := ""
+	if !at.IsZero() {
+		score = formatScore(q.score(at))
+	}
+
+	keys := []string{q.DedupPrefix + id, q.StreamName, q.DelayName, q.ScheduledPrefix + id}
+	pushed, err := streamPushUniqueScript.Run(q.Client, keys, message, int64(dedup/time.Millisecond), score, q.indexTTL(at), q.maxLen).Int64()
+	if pushed == 1 && score != "" {
+		signal(q.wake)
+	}
+
+	return pushed == 1, err
+}
+
+// Cancel removes a delayed message pushed by PushUnique, see DelayQueue.Cancel
+func (q *StreamQueue) Cancel(id string) (bool, error) {
+	removed, err := cancelScript.Run(q.Client, []string{q.ScheduledPrefix + id, q.DelayName}).Int64()
+	return removed == 1, err
+}
+
+// Reschedule moves a delayed message pushed by PushUnique to at, see DelayQueue.Reschedule
+func (q *StreamQueue) Reschedule(id string, at time.Time) (bool, error) {
+	moved, err := rescheduleScript.Run(q.Client, []string{q.ScheduledPrefix + id, q.DelayName}, formatScore(q.score(at)), q.indexTTL(at)).Int64()
+	if moved == 1 {
+		signal(q.wake)
+	}
+
+	return moved == 1, err
+}
+
+// CheckAndSwap moves due messages from the delay set to the stream, n at a time
+func (q *StreamQueue) CheckAndSwap(n int64) (int, error) {
+	if n <= 0 {
+		n = 1
+	}
+
+	count := 0
+	for {
+		moved, err := streamPromoteScript.Run(q.Client, []string{q.DelayName, q.StreamName}, q.score(q.now()), n, q.maxLen).Int64()
+		count += int(moved)
+		if err != nil || moved < n {
+			return count, err
+		}
+	}
+}
+
+// Run moves due messages to the stream and requeues those pending longer than the visibility
+// of the last FetchReliable, default 30s, until ctx is done, sleeping until the next one is due.
+func (q *StreamQueue) Run(ctx context.Context) error {
+	return q.runLoop(ctx, q.wake, q.promote)
+}
+
+func (q *StreamQueue) promote() (time.Duration, error) {
+	if _, err := q.CheckAndSwap(runBatch); err != nil {
+		return 0, err
+	}
+
+	// a zero visibility would claim every pending message at once
+	q.mu.Lock()
+	visibility := q.visibility
+	q.mu.Unlock()
+
+	if visibility > 0 {
+		if _, err := q.RequeueExpired(runBatch); err != nil {
+			return 0, err
+		}
+	}
+
+	next, err := q.Client.ZRangeWithScores(q.DelayName, 0, 0).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(next) == 0 {
+		return q.maxSleep, nil
+	}
+
+	return q.sleep(q.fromScore(next[0].Score)), nil
+}
+
+// FetchQueue reads up to n messages and acknowledges them at once
+func (q *StreamQueue) FetchQueue(n int64) ([]string, error) {
+	entries, err := q.read(n)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+
+	messages := make([]string, len(entries))
+	ids := make([]interface{}, 0, len(entries)+1)
+	ids = append(ids, q.Group)
+	for i, entry := range entries {
+		messages[i] = entryMessage(entry)
+		ids = append(ids, entry.ID)
+	}
+
+	return messages, streamAckScript.Run(q.Client, []string{q.StreamName}, ids...).Err()
+}
+
+// FetchReliable reads up to n messages, they stay pending in the group until Ack or Nack.
+// The handle of a delivery is its entry id. Messages pending longer than visibility are requeued by RequeueExpired.
+func (q *StreamQueue) FetchReliable(n int64, visibility time.Duration) ([]Delivery, error) {
+	q.mu.Lock()
+	q.visibility = visibility
+	q.mu.Unlock()
+
+	entries, err := q.read(n)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+
+	deliveries := make([]Delivery, len(entries))
+	for i, entry := range entries {
+		deliveries[i] = Delivery{Handle: entry.ID, Message: entryMessage(entry), Count: entryDeliveries(entry) + 1}
+	}
+
+	return deliveries, nil
+}
+
+// read new entries without blocking, n follows FetchQueue of DelayQueue
+func (q *StreamQueue) read(n int64) ([]redis.XMessage, error) {
+	if err := q.ensureGroup(); err != nil {
+		return nil, err
+	}
+
+	streams, err := q.Client.XReadGroup(&redis.XReadGroupArgs{
+		Group:    q.Group,
+		Consumer: q.Consumer,
+		Streams:  []string{q.StreamName, ">"},
+		Count:    n,
+		Block:    -1,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+
+	if err != nil || len(streams) == 0 {
+		return nil, err
+	}
+
+	return streams[0].Messages, nil
+}
+
+// ensureGroup creates the stream and its group on first use
+func (q *StreamQueue) ensureGroup() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.grouped {
+		return nil
+	}
+
+	err := q.Client.XGroupCreateMkStream(q.StreamName, q.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	q.grouped = true
+	return nil
+}
+
+// Ack acknowledges and deletes pending entries
+func (q *StreamQueue) Ack(handles ...string) error {
+	if len(handles) == 0 {
+		return nil
+	}
+
+	args := append([]interface{}{q.Group}, toInterfaces(handles)...)
+	return streamAckScript.Run(q.Client, []string{q.StreamName}, args...).Err()
+}
+
+// Nack appends pending entries back to the stream, it returns the number of requeued messages
+func (q *StreamQueue) Nack(handles ...string) (int64, error) {
+	if len(handles) == 0 {
+		return 0, nil
+	}
+
+	args := append([]interface{}{q.Group, q.maxLen}, toInterfaces(handles)...)
+	return streamRequeueScript.Run(q.Client, []string{q.StreamName}, args...).Int64()
+}
+
+// RequeueExpired claims up to n messages pending longer than the visibility of the last FetchReliable
+// from any consumer of the group with XAUTOCLAIM, and appends them back to the stream
+func (q *StreamQueue) RequeueExpired(n int64) (int64, error) {
+	if err := q.ensureGroup(); err != nil {
+		return 0, err
+	}
+
+	q.mu.Lock()
+	minIdle := int64(q.visibility / time.Millisecond)
+	q.mu.Unlock()
+
+	res, err := q.Client.Do("XAUTOCLAIM", q.StreamName, q.Group, q.Consumer, minIdle, "0-0", "COUNT", n).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	args := []interface{}{q.Group, q.maxLen}
+	for _, entry := range claimedEntries(res) {
+		args = append(args, entry.ID)
+	}
+
+	if len(args) == 2 {
+		return 0, nil
+	}
+
+	return streamRequeueScript.Run(q.Client, []string{q.StreamName}, args...).Int64()
+}
+
+// InFlight returns the number of messages pending in the group
+func (q *StreamQueue) InFlight() (int64, error) {
+	if err := q.ensureGroup(); err != nil {
+		return 0, err
+	}
+
+	pending, err := q.Client.XPending(q.StreamName, q.Group).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	return pending.Count, nil
+}
+
+// Retry moves a pending entry to the delay set as retried, due after delay
+func (q *StreamQueue) Retry(handle, retried string, delay time.Duration) (bool, error) {
+	keys := []string{q.StreamName, q.DelayName}
+	moved, err := streamRetryScript.Run(q.Client, keys, q.Group, handle, retried, q.score(q.now().Add(delay))).Int64()
+	if moved == 1 {
+		signal(q.wake)
+	}
+
+	return moved == 1, err
+}
+
+// Bury moves a pending entry to the dead letter queue as dead
+func (q *StreamQueue) Bury(handle, dead string) (bool, error) {
+	moved, err := streamBuryScript.Run(q.Client, []string{q.StreamName, q.DLQName}, q.Group, handle, dead).Int64()
+	return moved == 1, err
+}
+
+// Revive moves a dead message back to the stream as message
+func (q *StreamQueue) Revive(dead, message string) (bool, error) {
+	moved, err := streamReviveScript.Run(q.Client, []string{q.DLQName, q.StreamName}, dead, message, q.maxLen).Int64()
+	return moved == 1, err
+}
+
+// DeadLetters returns dead messages in range [start, stop], oldest first
+func (q *StreamQueue) DeadLetters(start, stop int64) ([]string, error) {
+	return q.Client.LRange(q.DLQName, start, stop).Result()
+}
+
+// DLQSize returns the number of dead messages
+func (q *StreamQueue) DLQSize() (int64, error) {
+	return q.Client.LLen(q.DLQName).Result()
+}
+
+// PurgeDLQ deletes all dead messages
+func (q *StreamQueue) PurgeDLQ() error {
+	return q.Client.Del(q.DLQName).Err()
+}
+
+// Size returns the number of delayed messages, see Stats
+func (q *StreamQueue) Size() (int64, error) {
+	return q.Client.ZCard(q.DelayName).Result()
+}
+
+// Trim caps the stream to about maxLen entries, dropping the oldest ready messages
+func (q *StreamQueue) Trim(maxLen int64) (int64, error) {
+	return q.Client.XTrimApprox(q.StreamName, maxLen).Result()
+}
+
+// Stats returns the depth and lag of the queue, messages of a non enveloped entry are aged by the entry id
+func (q *StreamQueue) Stats() (Stats, error) {
+	if err := q.ensureGroup(); err != nil {
+		return Stats{}, err
+	}
+
+	s := Stats{}
+	var err error
+	if s.Delayed, err = q.Client.ZCard(q.DelayName).Result(); err != nil {
+		return s, err
+	}
+
+	if s.InFlight, err = q.InFlight(); err != nil {
+		return s, err
+	}
+
+	length, err := q.Client.XLen(q.StreamName).Result()
+	if err != nil {
+		return s, err
+	}
+	s.Ready = length - s.InFlight
+
+	if s.Dead, err = q.Client.LLen(q.DLQName).Result(); err != nil {
+		return s, err
+	}
+
+	next, err := q.Client.ZRangeWithScores(q.DelayName, 0, 0).Result()
+	if err != nil {
+		return s, err
+	}
+
+	if len(next) > 0 {
+		s.NextDue = q.fromScore(next[0].Score)
+	}
+
+	if s.Ready > 0 {
+		s.OldestReady, err = q.oldestReady()
+	}
+
+	return s, err
+}
+
+// oldestReady ages the first entry not delivered to the group yet
+func (q *StreamQueue) oldestReady() (time.Duration, error) {
+	groups, err := q.Client.Do("XINFO", "GROUPS", q.StreamName).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	last := lastDeliveredID(groups, q.Group)
+	entries, err := q.Client.XRangeN(q.StreamName, last, "+", 2).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		if entry.ID == last {
+			continue
+		}
+
+		now := q.now()
+		if age := readyAge(entryMessage(entry), now); age > 0 {
+			return age, nil
+		}
+
+		ms, err := strconv.ParseInt(strings.SplitN(entry.ID, "-", 2)[0], 10, 64)
+		if err != nil || now.Before(time.Unix(0, ms*int64(time.Millisecond))) {
+			return 0, nil
+		}
+
+		return now.Sub(time.Unix(0, ms*int64(time.Millisecond))), nil
+	}
+
+	return 0, nil
+}
+
+// indexTTL returns milliseconds until the index of a message due at at expires
+func (q *StreamQueue) indexTTL(at time.Time) int64 {
+	ttl := at.Sub(q.now())
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	return int64((ttl + scheduledRetention) / time.Millisecond)
+}
+
+func entryMessage(entry redis.XMessage) string {
+	m, _ := entry.Values["m"].(string)
+	return m
+}
+
+// entryDeliveries returns how many times a requeued entry was delivered before
+func entryDeliveries(entry redis.XMessage) int64 {
+	d, _ := entry.Values["d"].(string)
+	n, _ := strconv.ParseInt(d, 10, 64)
+	return n
+}
+
+// claimedEntries parses the entries of a XAUTOCLAIM reply, entries deleted by trimming are skipped
+func claimedEntries(reply interface{}) []redis.XMessage {
+	parts, _ := reply.([]interface{})
+	if len(parts) < 2 {
+		return nil
+	}
+
+	raw, _ := parts[1].([]interface{})
+	entries := make([]redis.XMessage, 0, len(raw))
+	for _, r := range raw {
+		fields, _ := r.([]interface{})
+		if len(fields) < 2 {
+			continue
+		}
+
+		id, _ := fields[0].(string)
+		kv, _ := fields[1].([]interface{})
+		values := make(map[string]interface{}, len(kv)/2)
+		for i := 0; i+1 < len(kv); i += 2 {
+			k, _ := kv[i].(string)
+			values[k] = kv[i+1]
+		}
+
+		entries = append(entries, redis.XMessage{ID: id, Values: values})
+	}
+
+	return entries
+}
+
+// lastDeliveredID finds the last delivered id of group in a XINFO GROUPS reply
+func lastDeliveredID(reply interface{}, group string) string {
+	groups, _ := reply.([]interface{})
+	for _, g := range groups {
+		kv, _ := g.([]interface{})
+		info := make(map[string]interface{}, len(kv)/2)
+		for i := 0; i+1 < len(kv); i += 2 {
+			k, _ := kv[i].(string)
+			info[k] = kv[i+1]
+		}
+
+		if name, _ := info["name"].(string); name == group {
+			last, _ := info["last-delivered-id"].(string)
+			return last
+		}
+	}
+
+	return "0-0"
+}
@@ -0,0 +1,130 @@
+package q
+
+import (
+	"github.com/go-redis/redis"
+)
+
+// luaXadd appends a message as field m of a new entry, trimming the stream approximately when maxlen is positive.
+// A requeued message keeps its previous deliveries in field d.
+const luaXadd = `
+local function xadd(key, maxlen, message, delivered)
+	local fields = {'m', message}
+	if delivered then
+		fields[3] = 'd'
+		fields[4] = delivered
+	end
+	if tonumber(maxlen) > 0 then
+		return redis.call('XADD', key, 'MAXLEN', '~', maxlen, '*', unpack(fields))
+	end
+	return redis.call('XADD', key, '*', unpack(fields))
+end
+`
+
+// luaEntryField returns a field of the entry id of a stream, nil when the entry was deleted
+const luaEntryField = `
+local function entryField(key, id, field)
+	local entries = redis.call('XRANGE', key, id, id)
+	if #entries == 0 then
+		return nil
+	end
+	local fields = entries[1][2]
+	for i = 1, #fields, 2 do
+		if fields[i] == field then
+			return fields[i + 1]
+		end
+	end
+	return nil
+end
+`
+
+// Lua scripts of StreamQueue, an entry is acknowledged and deleted together so the stream only holds live entries
+var (
+	// KEYS[1] stream, ARGV[1] maxlen, ARGV[2:] messages
+	streamAddScript = redis.NewScript(luaXadd + `
+for i = 2, #ARGV do
+	xadd(KEYS[1], ARGV[1], ARGV[i])
+end
+return #ARGV - 1
+`)
+
+	// KEYS[1] delay, KEYS[2] stream, ARGV[1] max score, ARGV[2] count, ARGV[3] maxlen
+	streamPromoteScript = redis.NewScript(luaXadd + `
+local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, tonumber(ARGV[2]))
+for _, item in ipairs(items) do
+	redis.call('ZREM', KEYS[1], item)
+	xadd(KEYS[2], ARGV[3], item)
+end
+return #items
+`)
+
+	// KEYS[1] stream, ARGV[1] group, ARGV[2:] entry ids
+	streamAckScript = redis.NewScript(`
+local count = 0
+for i = 2, #ARGV do
+	if redis.call('XACK', KEYS[1], ARGV[1], ARGV[i]) == 1 then
+		redis.call('XDEL', KEYS[1], ARGV[i])
+		count = count + 1
+	end
+end
+return count
+`)
+
+	// KEYS[1] stream, ARGV[1] group, ARGV[2] maxlen, ARGV[3:] entry ids
+	streamRequeueScript = redis.NewScript(luaXadd + luaEntryField + `
+local count = 0
+for i = 3, #ARGV do
+	local message = entryField(KEYS[1], ARGV[i], 'm')
+	local delivered = tonumber(entryField(KEYS[1], ARGV[i], 'd') or '0') + 1
+	if redis.call('XACK', KEYS[1], ARGV[1], ARGV[i]) == 1 and message then
+		redis.call('XDEL', KEYS[1], ARGV[i])
+		xadd(KEYS[1], ARGV[2], message, delivered)
+		count = count + 1
+	end
+end
+return count
+`)
+
+	// KEYS[1] stream, KEYS[2] delay, ARGV[1] group, ARGV[2] entry id, ARGV[3] retried message, ARGV[4] score
+	streamRetryScript = redis.NewScript(`
+if redis.call('XACK', KEYS[1], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call('XDEL', KEYS[1], ARGV[2])
+redis.call('ZADD', KEYS[2], ARGV[4], ARGV[3])
+return 1
+`)
+
+	// KEYS[1] stream, KEYS[2] dlq, ARGV[1] group, ARGV[2] entry id, ARGV[3] dead message
+	streamBuryScript = redis.NewScript(`
+if redis.call('XACK', KEYS[1], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call('XDEL', KEYS[1], ARGV[2])
+redis.call('RPUSH', KEYS[2], ARGV[3])
+return 1
+`)
+
+	// KEYS[1] dlq, KEYS[2] stream, ARGV[1] dead message, ARGV[2] message, ARGV[3] maxlen
+	streamReviveScript = redis.NewScript(luaXadd + `
+if redis.call('LREM', KEYS[1], 1, ARGV[1]) == 0 then
+	return 0
+end
+xadd(KEYS[2], ARGV[3], ARGV[2])
+return 1
+`)
+
+	// KEYS[1] dedup, KEYS[2] stream, KEYS[3] delay, KEYS[4] index,
+	// ARGV[1] message, ARGV[2] dedup window ms, ARGV[3] score or empty to enqueue now, ARGV[4] index ttl ms, ARGV[5] maxlen
+	streamPushUniqueScript = redis.NewScript(luaXadd + `
+if tonumber(ARGV[2]) > 0 and not redis.call('SET', KEYS[1], 1, 'NX', 'PX', ARGV[2]) then
+	return 0
+end
+if ARGV[3] == '' then
+	xadd(KEYS[2], ARGV[5], ARGV[1])
+else
+	redis.call('ZADD', KEYS[3], ARGV[3], ARGV[1])
+	redis.call('SET', KEYS[4], ARGV[1], 'PX', ARGV[4])
+end
+return 1
+`)
+)
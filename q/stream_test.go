@@ -0,0 +1,141 @@
+package q
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/sunary/kitchen/wk"
+)
+
+func newTestStreamQueue(t *testing.T, opts ...Option) (*StreamQueue, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis.Run() error = %v", err)
+	}
+	t.Cleanup(mr.Close)
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return NewStreamQueue(client, "test", "workers", "worker-1", opts...), mr
+}
+
+func TestStreamQueue_Group(t *testing.T) {
+	first, mr := newTestStreamQueue(t)
+	second := NewStreamQueue(first.Client, "test", "workers", "worker-2")
+	start := time.Unix(1700000000, 0)
+	mr.SetTime(start)
+
+	_ = first.PushQueue("a", "b", "c", "d")
+
+	got1, _ := first.FetchReliable(2, time.Minute)
+	got2, _ := second.FetchReliable(10, time.Minute)
+	if !reflect.DeepEqual(messagesOf(got1), []string{"a", "b"}) || !reflect.DeepEqual(messagesOf(got2), []string{"c", "d"}) {
+		t.Fatalf("FetchReliable() = %v and %v, want messages shared by the group", got1, got2)
+	}
+
+	_ = second.Ack(handlesOf(got2)...)
+
+	// first consumer crashes, its pending messages are claimed after the visibility timeout
+	mr.SetTime(start.Add(time.Minute))
+	if n, err := second.RequeueExpired(10); n != 2 || err != nil {
+		t.Fatalf("RequeueExpired() = %v, %v, want 2", n, err)
+	}
+
+	if got, _ := second.FetchQueue(10); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("FetchQueue() = %v, want [a b]", got)
+	}
+
+	if n, _ := second.InFlight(); n != 0 {
+		t.Errorf("InFlight() = %v, want 0", n)
+	}
+
+	if n, _ := second.Client.XLen(second.StreamName).Result(); n != 0 {
+		t.Errorf("stream length = %v, want acknowledged entries deleted", n)
+	}
+
+	// a late ack of the crashed consumer does not touch the requeued entries
+	if err := first.Ack(handlesOf(got1)...); err != nil {
+		t.Errorf("Ack() error = %v", err)
+	}
+}
+
+func TestStreamQueue_Trim(t *testing.T) {
+	q, _ := newTestStreamQueue(t, WithMaxLen(2))
+
+	for i := 0; i < 5; i++ {
+		_ = q.PushQueue("m")
+	}
+
+	if n, _ := q.Client.XLen(q.StreamName).Result(); n != 2 {
+		t.Errorf("stream length = %v, want trimmed to 2", n)
+	}
+
+	q.maxLen = 0
+	_ = q.PushQueue("a", "b", "c")
+	if n, err := q.Trim(1); n != 4 || err != nil {
+		t.Errorf("Trim() = %v, %v, want 4", n, err)
+	}
+}
+
+func TestStreamQueue_OldestReady(t *testing.T) {
+	q, mr := newTestStreamQueue(t)
+	start := time.Unix(1700000000, 0)
+	mr.SetTime(start)
+	q.now = func() time.Time { return start.Add(3 * time.Second) }
+
+	_ = q.PushQueue("a", "b")
+	_, _ = q.FetchReliable(1, time.Minute)
+
+	mr.SetTime(start.Add(time.Second))
+	_ = q.PushQueue("c")
+
+	s, err := q.Stats()
+	if err != nil || s.Ready != 2 || s.InFlight != 1 || s.OldestReady != 3*time.Second {
+		t.Errorf("Stats() = %+v, %v, want 2 ready aged 3s and 1 in flight", s, err)
+	}
+}
+
+func TestConsumer_Stream(t *testing.T) {
+	sq, _ := newTestStreamQueue(t)
+	queue := NewQueue[event](sq, nil)
+
+	pool := wk.NewPool(context.Background(), 2)
+	pool.Start()
+	defer pool.Stop()
+
+	handled := make(chan int, 10)
+	failed := false
+	c := NewConsumer(context.Background(), queue, pool, func(ctx context.Context, ev event) error {
+		if ev.ID == 2 && !failed {
+			failed = true
+			return errors.New("temporary")
+		}
+
+		handled <- ev.ID
+		return nil
+	}, WithPollInterval(time.Millisecond), WithRetryBackoff(time.Millisecond, time.Millisecond))
+	c.Start()
+
+	_ = queue.Add(event{ID: 1}, event{ID: 2})
+
+	seen := map[int]bool{}
+	for len(seen) < 2 {
+		select {
+		case id := <-handled:
+			seen[id] = true
+		case <-time.After(2 * time.Second):
+			t.Fatalf("handled %v, want events 1 and 2", seen)
+		}
+	}
+
+	c.Stop()
+	if s, _ := sq.Stats(); s.Ready != 0 || s.InFlight != 0 || s.Delayed != 0 {
+		t.Errorf("Stats() = %+v, want an empty queue", s)
+	}
+}
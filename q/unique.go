@@ -0,0 +1,65 @@
+package q
+
+import (
+	"strconv"
+	"time"
+)
+
+// scheduledRetention is how long the id index of a delayed message outlives its due time
+const scheduledRetention = time.Hour
+
+// PushUnique enqueues a message identified by id, at a zero time enqueues it now.
+// With a positive dedup window, a message with the same id pushed within the window is dropped and false is returned.
+// Delayed messages can be cancelled or rescheduled by id.
+func (q *DelayQueue) PushUnique(id, message string, at time.Time, dedup time.Duration) (bool, error) {
+	score := ""
+	if !at.IsZero() {
+		score = formatScore(q.score(at))
+	}
+
+	keys := []string{q.dedupKey(id), q.QueueName, q.DelayName, q.indexKey(id)}
+	pushed, err := pushUniqueScript.Run(q.Client, keys, message, int64(dedup/time.Millisecond), score, q.indexTTL(at)).Int64()
+	if pushed == 1 && score != "" {
+		signal(q.wake)
+	}
+
+	return pushed == 1, err
+}
+
+// Cancel removes a delayed message pushed by PushUnique, it returns false when the message is already due or unknown
+func (q *DelayQueue) Cancel(id string) (bool, error) {
+	removed, err := cancelScript.Run(q.Client, []string{q.indexKey(id), q.DelayName}).Int64()
+	return removed == 1, err
+}
+
+// Reschedule moves a delayed message pushed by PushUnique to at, it returns false when the message is already due or unknown
+func (q *DelayQueue) Reschedule(id string, at time.Time) (bool, error) {
+	moved, err := rescheduleScript.Run(q.Client, []string{q.indexKey(id), q.DelayName}, formatScore(q.score(at)), q.indexTTL(at)).Int64()
+	if moved == 1 {
+		signal(q.wake)
+	}
+
+	return moved == 1, err
+}
+
+func (q *DelayQueue) dedupKey(id string) string {
+	return q.DedupPrefix + id
+}
+
+func (q *DelayQueue) indexKey(id string) string {
+	return q.ScheduledPrefix + id
+}
+
+// indexTTL returns milliseconds until the index of a message due at at expires
+func (q *DelayQueue) indexTTL(at time.Time) int64 {
+	ttl := at.Sub(q.now())
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	return int64((ttl + scheduledRetention) / time.Millisecond)
+}
+
+func formatScore(score float64) string {
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
@@ -0,0 +1,44 @@
+package rl
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// TokenBucket holds up to limit tokens refilled evenly over window, allowing bursts of a full bucket
+type TokenBucket struct {
+	limiter
+}
+
+// NewTokenBucket create new token bucket limiter of limit tokens refilled in window of at least 1ms
+func NewTokenBucket(client *redis.Client, limit int64, window time.Duration, opts ...Option) (*TokenBucket, error) {
+	l, err := newLimiter(client, limit, window, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenBucket{l}, nil
+}
+
+// Allow takes one token of key
+func (l *TokenBucket) Allow(key string) (Result, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN takes n tokens of key
+func (l *TokenBucket) AllowN(key string, n int64) (Result, error) {
+	if err := l.check(n); err != nil {
+		return Result{}, err
+	}
+
+	rate := float64(l.limit) / float64(l.window.Milliseconds())
+	return result(tokenBucketScript.Run(l.Client, []string{l.prefix + key}, l.limit, n,
+		strconv.FormatFloat(rate, 'g', -1, 64), toMillis(l.now())).Result())
+}
+
+// Reset refills the bucket of key
+func (l *TokenBucket) Reset(key string) error {
+	return l.Del(l.prefix + key).Err()
+}
@@ -0,0 +1,137 @@
+package rl
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+var (
+	// ErrLimitExceeded is returned when more permits are asked at once than the limit allows
+	ErrLimitExceeded = errors.New("rl: n exceeds limit")
+	// ErrInvalidN is returned when n is not positive
+	ErrInvalidN = errors.New("rl: n must be positive")
+	// ErrInvalidLimit is returned by constructors when limit is not positive
+	ErrInvalidLimit = errors.New("rl: limit must be positive")
+	// ErrInvalidWindow is returned by constructors when window is shorter than a millisecond
+	ErrInvalidWindow = errors.New("rl: window must be at least 1ms")
+)
+
+// Limiter allows at most limit permits per window and key, shared by all processes using the same redis
+type Limiter interface {
+	// Allow takes one permit of key
+	Allow(key string) (Result, error)
+	// AllowN takes n permits of key at once, or none of them
+	AllowN(key string, n int64) (Result, error)
+	// Reset drops the state of key
+	Reset(key string) error
+}
+
+// Result is the decision of a limiter
+type Result struct {
+	Allowed bool
+	// Remaining permits after this call
+	Remaining int64
+	// RetryAfter is the wait until the denied permits are available, 0 when allowed
+	RetryAfter time.Duration
+	// ResetAfter is the wait until all permits are available again
+	ResetAfter time.Duration
+}
+
+type options struct {
+	now    func() time.Time
+	prefix string
+}
+
+// Option configures a limiter
+type Option func(*options)
+
+// WithPrefix sets the prefix of redis keys, default "rl:"
+func WithPrefix(prefix string) Option {
+	return func(o *options) {
+		o.prefix = prefix
+	}
+}
+
+type limiter struct {
+	*redis.Client
+	limit  int64
+	window time.Duration
+	options
+}
+
+func newLimiter(client *redis.Client, limit int64, window time.Duration, opts []Option) (limiter, error) {
+	if limit <= 0 {
+		return limiter{}, ErrInvalidLimit
+	}
+
+	// windows are counted in milliseconds by the scripts
+	if window < time.Millisecond {
+		return limiter{}, ErrInvalidWindow
+	}
+
+	o := options{
+		now:    time.Now,
+		prefix: "rl:",
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return limiter{
+		Client:  client,
+		limit:   limit,
+		window:  window,
+		options: o,
+	}, nil
+}
+
+func (l *limiter) check(n int64) error {
+	if n <= 0 {
+		return ErrInvalidN
+	}
+
+	if n > l.limit {
+		return ErrLimitExceeded
+	}
+
+	return nil
+}
+
+// result parses {allowed, remaining, retry after ms, reset after ms} returned by the scripts
+func result(v interface{}, err error) (Result, error) {
+	if err != nil {
+		return Result{}, err
+	}
+
+	values, ok := v.([]interface{})
+	if !ok || len(values) != 4 {
+		return Result{}, errors.New("rl: unexpected script result")
+	}
+
+	ints := make([]int64, len(values))
+	for i := range values {
+		if ints[i], ok = values[i].(int64); !ok {
+			return Result{}, errors.New("rl: unexpected script result")
+		}
+	}
+
+	return Result{
+		Allowed:    ints[0] == 1,
+		Remaining:  ints[1],
+		RetryAfter: time.Duration(ints[2]) * time.Millisecond,
+		ResetAfter: time.Duration(ints[3]) * time.Millisecond,
+	}, nil
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+var (
+	_ Limiter = (*FixedWindow)(nil)
+	_ Limiter = (*SlidingLog)(nil)
+	_ Limiter = (*TokenBucket)(nil)
+)
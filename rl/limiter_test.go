@@ -0,0 +1,172 @@
+package rl
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+)
+
+func newTestClient(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatalf("miniredis.Run() error = %v", err)
+	}
+	t.Cleanup(mr.Close)
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+
+	return client, mr
+}
+
+type step struct {
+	at   time.Duration
+	n    int64
+	want Result
+}
+
+func TestLimiter(t *testing.T) {
+	client, mr := newTestClient(t)
+	start := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name    string
+		limiter func(opts ...Option) Limiter
+		steps   []step
+	}{
+		{
+			name: "fixed window",
+			limiter: func(opts ...Option) Limiter {
+				l, _ := NewFixedWindow(client, 3, time.Second, opts...)
+				return l
+			},
+			steps: []step{
+				{at: 0, n: 2, want: Result{Allowed: true, Remaining: 1, ResetAfter: time.Second}},
+				{at: 400 * time.Millisecond, n: 2, want: Result{Remaining: 1, RetryAfter: 600 * time.Millisecond, ResetAfter: 600 * time.Millisecond}},
+				{at: 400 * time.Millisecond, n: 1, want: Result{Allowed: true, ResetAfter: 600 * time.Millisecond}},
+				{at: time.Second, n: 3, want: Result{Allowed: true, ResetAfter: time.Second}},
+			},
+		},
+		{
+			name: "sliding log",
+			limiter: func(opts ...Option) Limiter {
+				l, _ := NewSlidingLog(client, 3, time.Second, opts...)
+				return l
+			},
+			steps: []step{
+				{at: 0, n: 2, want: Result{Allowed: true, Remaining: 1, ResetAfter: time.Second}},
+				{at: 400 * time.Millisecond, n: 1, want: Result{Allowed: true, ResetAfter: time.Second}},
+				{at: time.Second, n: 2, want: Result{Allowed: true, Remaining: 0, ResetAfter: time.Second}},
+				{at: 1200 * time.Millisecond, n: 1, want: Result{RetryAfter: 200 * time.Millisecond, ResetAfter: 800 * time.Millisecond}},
+				{at: 1400 * time.Millisecond, n: 1, want: Result{Allowed: true, ResetAfter: time.Second}},
+			},
+		},
+		{
+			name: "token bucket",
+			limiter: func(opts ...Option) Limiter {
+				l, _ := NewTokenBucket(client, 4, time.Second, opts...)
+				return l
+			},
+			steps: []step{
+				{at: 0, n: 4, want: Result{Allowed: true, ResetAfter: time.Second}},
+				{at: 100 * time.Millisecond, n: 1, want: Result{RetryAfter: 150 * time.Millisecond, ResetAfter: 900 * time.Millisecond}},
+				{at: 500 * time.Millisecond, n: 2, want: Result{Allowed: true, ResetAfter: time.Second}},
+				{at: 5 * time.Second, n: 1, want: Result{Allowed: true, Remaining: 3, ResetAfter: 250 * time.Millisecond}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := start
+			l := tt.limiter(WithPrefix(tt.name+":"), func(o *options) {
+				o.now = func() time.Time { return now }
+			})
+
+			for _, s := range tt.steps {
+				mr.FastForward(start.Add(s.at).Sub(now))
+				now = start.Add(s.at)
+
+				if got, err := l.AllowN("k", s.n); got != s.want || err != nil {
+					t.Errorf("AllowN(%v) at %v = %+v, %v, want %+v", s.n, s.at, got, err, s.want)
+				}
+			}
+
+			if _, err := l.AllowN("k", 5); err != ErrLimitExceeded {
+				t.Errorf("AllowN() above limit error = %v, want %v", err, ErrLimitExceeded)
+			}
+
+			for _, n := range []int64{0, -1} {
+				if _, err := l.AllowN("k", n); err != ErrInvalidN {
+					t.Errorf("AllowN(%v) error = %v, want %v", n, err, ErrInvalidN)
+				}
+			}
+
+			if err := l.Reset("k"); err != nil {
+				t.Fatalf("Reset() error = %v", err)
+			}
+			if got, _ := l.Allow("k"); !got.Allowed {
+				t.Errorf("Allow() after Reset() = %+v, want allowed", got)
+			}
+		})
+	}
+}
+
+func TestLimiter_Keys(t *testing.T) {
+	client, _ := newTestClient(t)
+	l, err := NewSlidingLog(client, 1, time.Minute)
+	if err != nil {
+		t.Fatalf("NewSlidingLog() error = %v", err)
+	}
+
+	if got, _ := l.Allow("a"); !got.Allowed {
+		t.Errorf("Allow(a) = %+v, want allowed", got)
+	}
+	if got, _ := l.Allow("a"); got.Allowed {
+		t.Errorf("Allow(a) twice = %+v, want denied", got)
+	}
+	if got, _ := l.Allow("b"); !got.Allowed {
+		t.Errorf("Allow(b) = %+v, want allowed", got)
+	}
+}
+
+func TestLimiter_Invalid(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	constructors := map[string]func(limit int64, window time.Duration) error{
+		"fixed window": func(limit int64, window time.Duration) error {
+			_, err := NewFixedWindow(client, limit, window)
+			return err
+		},
+		"sliding log": func(limit int64, window time.Duration) error {
+			_, err := NewSlidingLog(client, limit, window)
+			return err
+		},
+		"token bucket": func(limit int64, window time.Duration) error {
+			_, err := NewTokenBucket(client, limit, window)
+			return err
+		},
+	}
+
+	tests := []struct {
+		name   string
+		limit  int64
+		window time.Duration
+		want   error
+	}{
+		{name: "valid", limit: 1, window: time.Millisecond},
+		{name: "zero limit", limit: 0, window: time.Second, want: ErrInvalidLimit},
+		{name: "negative limit", limit: -1, window: time.Second, want: ErrInvalidLimit},
+		{name: "sub millisecond window", limit: 1, window: time.Microsecond, want: ErrInvalidWindow},
+		{name: "zero window", limit: 1, window: 0, want: ErrInvalidWindow},
+	}
+	for name, newLimiter := range constructors {
+		for _, tt := range tests {
+			if err := newLimiter(tt.limit, tt.window); err != tt.want {
+				t.Errorf("%v %v error = %v, want %v", name, tt.name, err, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package rl
+
+import (
+	"github.com/go-redis/redis"
+)
+
+// Lua scripts of the limiters, all return {allowed, remaining, retry after ms, reset after ms}
+var (
+	// KEYS[1] counter of the current window, ARGV[1] limit, ARGV[2] n, ARGV[3] ms until the window ends
+	fixedWindowScript = redis.NewScript(`
+local limit, n, reset = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local count = tonumber(redis.call('GET', KEYS[1]) or '0')
+if count + n > limit then
+	return {0, limit - count, reset, reset}
+end
+count = redis.call('INCRBY', KEYS[1], n)
+if count == n then
+	redis.call('PEXPIRE', KEYS[1], reset)
+end
+return {1, limit - count, 0, reset}
+`)
+
+	// KEYS[1] log, ARGV[1] limit, ARGV[2] n, ARGV[3] window ms, ARGV[4] now ms, ARGV[5] unique member prefix
+	slidingLogScript = redis.NewScript(`
+local limit, n, window, now = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+if count + n > limit then
+	local oldest = redis.call('ZRANGE', KEYS[1], count + n - limit - 1, count + n - limit - 1, 'WITHSCORES')
+	local newest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+	return {0, limit - count, tonumber(oldest[2]) + window - now, tonumber(newest[2]) + window - now}
+end
+for i = 1, n do
+	redis.call('ZADD', KEYS[1], now, ARGV[5] .. i)
+end
+redis.call('PEXPIRE', KEYS[1], window)
+return {1, limit - count - n, 0, window}
+`)
+
+	// KEYS[1] bucket, ARGV[1] capacity, ARGV[2] n, ARGV[3] tokens per ms, ARGV[4] now ms
+	tokenBucketScript = redis.NewScript(`
+local capacity, n, rate, now = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3]), tonumber(ARGV[4])
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens, ts = tonumber(bucket[1]) or capacity, tonumber(bucket[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+local allowed, retry = 0, math.ceil((n - tokens) / rate)
+if tokens >= n then
+	tokens = tokens - n
+	allowed, retry = 1, 0
+end
+local reset = math.ceil((capacity - tokens) / rate)
+redis.call('HMSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.max(reset, 1))
+return {allowed, math.floor(tokens), retry, reset}
+`)
+)
@@ -0,0 +1,83 @@
+package rl
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/sunary/kitchen/id"
+)
+
+// FixedWindow counts permits in consecutive windows, bursts up to twice the limit may pass around a window boundary
+type FixedWindow struct {
+	limiter
+}
+
+// NewFixedWindow create new fixed window limiter allowing limit permits per window of at least 1ms
+func NewFixedWindow(client *redis.Client, limit int64, window time.Duration, opts ...Option) (*FixedWindow, error) {
+	l, err := newLimiter(client, limit, window, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FixedWindow{l}, nil
+}
+
+// Allow takes one permit of key
+func (l *FixedWindow) Allow(key string) (Result, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN takes n permits of key in the current window
+func (l *FixedWindow) AllowN(key string, n int64) (Result, error) {
+	if err := l.check(n); err != nil {
+		return Result{}, err
+	}
+
+	now, window := toMillis(l.now()), l.window.Milliseconds()
+	return result(fixedWindowScript.Run(l.Client, []string{l.key(key, now)}, l.limit, n, window-now%window).Result())
+}
+
+// Reset drops the counter of the current window of key
+func (l *FixedWindow) Reset(key string) error {
+	return l.Del(l.key(key, toMillis(l.now()))).Err()
+}
+
+func (l *FixedWindow) key(key string, now int64) string {
+	return l.prefix + key + ":" + strconv.FormatInt(now/l.window.Milliseconds(), 10)
+}
+
+// SlidingLog records each permit, allowing exactly limit permits in any window at the cost of memory per permit
+type SlidingLog struct {
+	limiter
+}
+
+// NewSlidingLog create new sliding log limiter allowing limit permits in any window of at least 1ms
+func NewSlidingLog(client *redis.Client, limit int64, window time.Duration, opts ...Option) (*SlidingLog, error) {
+	l, err := newLimiter(client, limit, window, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SlidingLog{l}, nil
+}
+
+// Allow takes one permit of key
+func (l *SlidingLog) Allow(key string) (Result, error) {
+	return l.AllowN(key, 1)
+}
+
+// AllowN takes n permits of key in the window ending now
+func (l *SlidingLog) AllowN(key string, n int64) (Result, error) {
+	if err := l.check(n); err != nil {
+		return Result{}, err
+	}
+
+	return result(slidingLogScript.Run(l.Client, []string{l.prefix + key}, l.limit, n,
+		l.window.Milliseconds(), toMillis(l.now()), id.NewUUID().String()+":").Result())
+}
+
+// Reset drops the log of key
+func (l *SlidingLog) Reset(key string) error {
+	return l.Del(l.prefix + key).Err()
+}
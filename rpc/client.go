@@ -0,0 +1,310 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sunary/kitchen/l"
+	"github.com/sunary/kitchen/wk"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// LogUnaryClientInterceptor returns client middleware logging method, duration and status with zap.
+// Details of failed calls are decoded, errors in excepts are logged as warnings.
+func LogUnaryClientInterceptor(logger l.Logger, excepts ...error) grpc.UnaryClientInterceptor {
+	getLogFn := newLogFn(excepts)
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		logClientCall(getLogFn, logger.Ctx(ctx), method, time.Now().Sub(start), err)
+		return err
+	}
+}
+
+// LogStreamClientInterceptor returns stream client middleware logging when the stream ends, see LogUnaryClientInterceptor
+func LogStreamClientInterceptor(logger l.Logger, excepts ...error) grpc.StreamClientInterceptor {
+	getLogFn := newLogFn(excepts)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			logClientCall(getLogFn, logger.Ctx(ctx), method, time.Now().Sub(start), err)
+			return nil, err
+		}
+
+		return newClientStream(desc, cs, func(err error) {
+			logClientCall(getLogFn, logger.Ctx(ctx), method, time.Now().Sub(start), err)
+		}), nil
+	}
+}
+
+func logClientCall(getLogFn func(logger l.Logger, v interface{}) func(msg string, fields ...zapcore.Field), logger l.Logger, method string, t time.Duration, err error) {
+	if err == nil {
+		getLogFn(logger, nil)(method, l.Duration("t", t), l.Stringer("code", codes.OK))
+		return
+	}
+
+	getLogFn(logger, err)(method, l.Duration("t", t), l.Stringer("code", status.Code(err)), l.Interface("\n⇐ERROR", DecodeErrorWithDetails(err)))
+}
+
+// TimeoutUnaryClientInterceptor returns client middleware applying timeout to calls without deadline
+func TimeoutUnaryClientInterceptor(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// TimeoutStreamClientInterceptor returns stream client middleware applying timeout to whole streams without deadline
+func TimeoutStreamClientInterceptor(timeout time.Duration) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if _, ok := ctx.Deadline(); ok {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		return newClientStream(desc, cs, func(error) { cancel() }), nil
+	}
+}
+
+type retryOptions struct {
+	max            int
+	codes          map[codes.Code]struct{}
+	methods        map[string]struct{}
+	baseDelay      time.Duration
+	maxDelay       time.Duration
+	attemptTimeout time.Duration
+}
+
+// RetryOption configures retry client interceptors
+type RetryOption func(*retryOptions)
+
+// WithRetryMax sets the number of retries after the first attempt, default 3
+func WithRetryMax(n int) RetryOption {
+	return func(o *retryOptions) {
+		o.max = n
+	}
+}
+
+// WithRetryCodes sets the codes retried, default codes.Unavailable and codes.ResourceExhausted
+func WithRetryCodes(cs ...codes.Code) RetryOption {
+	return func(o *retryOptions) {
+		o.codes = make(map[codes.Code]struct{}, len(cs))
+		for _, c := range cs {
+			o.codes[c] = struct{}{}
+		}
+	}
+}
+
+// WithRetryMethods lists the idempotent full methods like "/pkg.Service/Get" which are retried, default none.
+// Calls of other methods are retried only when made with the Idempotent call option.
+func WithRetryMethods(methods ...string) RetryOption {
+	return func(o *retryOptions) {
+		o.methods = make(map[string]struct{}, len(methods))
+		for _, m := range methods {
+			o.methods[m] = struct{}{}
+		}
+	}
+}
+
+// WithRetryBackoff waits exponentially between attempts, starting from base and capped at max, default 50ms to 5s.
+// Delays are computed by wk.Backoff.
+func WithRetryBackoff(base, max time.Duration) RetryOption {
+	return func(o *retryOptions) {
+		o.baseDelay = base
+		o.maxDelay = max
+	}
+}
+
+// WithRetryAttemptTimeout sets the deadline of each attempt, an attempt timing out is retried while ctx is not done
+func WithRetryAttemptTimeout(d time.Duration) RetryOption {
+	return func(o *retryOptions) {
+		o.attemptTimeout = d
+	}
+}
+
+func newRetryOptions(opts []RetryOption) retryOptions {
+	o := retryOptions{
+		max:       3,
+		baseDelay: 50 * time.Millisecond,
+		maxDelay:  5 * time.Second,
+	}
+	WithRetryCodes(codes.Unavailable, codes.ResourceExhausted)(&o)
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
+// Idempotent marks a call as safe to retry by the retry client interceptors
+func Idempotent() grpc.CallOption {
+	return idempotentOption{}
+}
+
+type idempotentOption struct {
+	grpc.EmptyCallOption
+}
+
+// RetryUnaryClientInterceptor returns client middleware retrying failed calls of idempotent methods with backoff,
+// see WithRetryMethods and Idempotent.
+// The retry-after header set by RateLimitUnaryServerInterceptor is waited when longer than the backoff.
+func RetryUnaryClientInterceptor(opts ...RetryOption) grpc.UnaryClientInterceptor {
+	o := newRetryOptions(opts)
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if !o.retryCall(method, opts) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		for attempt := 1; ; attempt++ {
+			var header metadata.MD
+			err := o.attempt(ctx, func(ctx context.Context) error {
+				return invoker(ctx, method, req, reply, cc, append(opts, grpc.Header(&header))...)
+			})
+
+			if !o.retryable(ctx, attempt, err) {
+				return err
+			}
+
+			if err := o.wait(ctx, attempt, header); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// RetryStreamClientInterceptor returns stream client middleware retrying failures to open streams with backoff.
+// Errors of an established stream are not retried since messages may have been exchanged.
+func RetryStreamClientInterceptor(opts ...RetryOption) grpc.StreamClientInterceptor {
+	o := newRetryOptions(opts)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if !o.retryCall(method, opts) {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+
+		for attempt := 1; ; attempt++ {
+			cs, err := streamer(ctx, desc, cc, method, opts...)
+			if !o.retryable(ctx, attempt, err) {
+				return cs, err
+			}
+
+			if err := o.wait(ctx, attempt, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// retryCall reports whether a call is idempotent, retrying other calls could apply them twice
+func (o *retryOptions) retryCall(method string, opts []grpc.CallOption) bool {
+	for _, opt := range opts {
+		if _, ok := opt.(idempotentOption); ok {
+			return true
+		}
+	}
+
+	_, ok := o.methods[method]
+	return ok
+}
+
+func (o *retryOptions) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if o.attemptTimeout <= 0 {
+		return fn(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, o.attemptTimeout)
+	defer cancel()
+
+	return fn(ctx)
+}
+
+func (o *retryOptions) retryable(ctx context.Context, attempt int, err error) bool {
+	if err == nil || attempt > o.max || ctx.Err() != nil {
+		return false
+	}
+
+	code := status.Code(err)
+	if code == codes.DeadlineExceeded && o.attemptTimeout > 0 {
+		return true
+	}
+
+	_, ok := o.codes[code]
+	return ok
+}
+
+// wait sleeps before the next attempt, or returns the status of ctx when it is done first
+func (o *retryOptions) wait(ctx context.Context, attempt int, header metadata.MD) error {
+	d := wk.Backoff(o.baseDelay, o.maxDelay, attempt)
+	if values := header.Get("retry-after"); len(values) > 0 {
+		if secs, err := strconv.Atoi(values[0]); err == nil && time.Duration(secs)*time.Second > d {
+			d = time.Duration(secs) * time.Second
+		}
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return status.FromContextError(ctx.Err()).Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// clientStream calls done once with the final status of the stream, nil when it ended with io.EOF
+type clientStream struct {
+	grpc.ClientStream
+	single bool
+	done   func(error)
+	once   sync.Once
+}
+
+func newClientStream(desc *grpc.StreamDesc, cs grpc.ClientStream, done func(error)) grpc.ClientStream {
+	return &clientStream{
+		ClientStream: cs,
+		single:       !desc.ServerStreams,
+		done:         done,
+	}
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	// a stream without server streaming ends with its only response
+	if err != nil || s.single {
+		s.finish(err)
+	}
+
+	return err
+}
+
+func (s *clientStream) finish(err error) {
+	if err == io.EOF {
+		err = nil
+	}
+
+	s.once.Do(func() { s.done(err) })
+}
@@ -0,0 +1,203 @@
+package rpc
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// failing fails the first n calls with code then echoes
+func failing(n int32, code codes.Code, calls *int32) testServer {
+	ts := echo()
+	ts.unary = func(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+		if atomic.AddInt32(calls, 1) <= n {
+			return nil, status.Error(code, "failed")
+		}
+		return req, nil
+	}
+	return ts
+}
+
+func TestRetryUnaryClientInterceptor(t *testing.T) {
+	tests := []struct {
+		name      string
+		fails     int32
+		code      codes.Code
+		opts      []RetryOption
+		callOpts  []grpc.CallOption
+		wantCalls int32
+		wantCode  codes.Code
+	}{
+		{name: "method not listed", fails: 2, code: codes.Unavailable, wantCalls: 1, wantCode: codes.Unavailable},
+		{name: "method listed", fails: 2, code: codes.Unavailable, opts: []RetryOption{WithRetryMethods(testUnaryMethod)}, wantCalls: 3, wantCode: codes.OK},
+		{name: "idempotent call", fails: 2, code: codes.Unavailable, callOpts: []grpc.CallOption{Idempotent()}, wantCalls: 3, wantCode: codes.OK},
+		{name: "code not retried", fails: 2, code: codes.InvalidArgument, callOpts: []grpc.CallOption{Idempotent()}, wantCalls: 1, wantCode: codes.InvalidArgument},
+		{name: "retries exhausted", fails: 5, code: codes.Unavailable, opts: []RetryOption{WithRetryMax(2)}, callOpts: []grpc.CallOption{Idempotent()}, wantCalls: 3, wantCode: codes.Unavailable},
+		{name: "custom codes", fails: 1, code: codes.Aborted, opts: []RetryOption{WithRetryCodes(codes.Aborted)}, callOpts: []grpc.CallOption{Idempotent()}, wantCalls: 2, wantCode: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			opts := append([]RetryOption{WithRetryBackoff(time.Millisecond, time.Millisecond)}, tt.opts...)
+			conn := newTestConn(t, failing(tt.fails, tt.code, &calls), nil, grpc.WithUnaryInterceptor(RetryUnaryClientInterceptor(opts...)))
+
+			reply := new(wrapperspb.StringValue)
+			err := conn.Invoke(context.Background(), testUnaryMethod, wrapperspb.String("v"), reply, tt.callOpts...)
+			if got := status.Code(err); got != tt.wantCode {
+				t.Errorf("Invoke() code = %v, want %v", got, tt.wantCode)
+			}
+
+			if err == nil && reply.Value != "v" {
+				t.Errorf("Invoke() reply = %q, want v", reply.Value)
+			}
+
+			if calls != tt.wantCalls {
+				t.Errorf("server called %v times, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryUnaryClientInterceptor_RetryAfter(t *testing.T) {
+	var calls int32
+	ts := echo()
+	ts.unary = func(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", "1"))
+			return nil, status.Error(codes.ResourceExhausted, "too many requests")
+		}
+		return req, nil
+	}
+
+	conn := newTestConn(t, ts, nil, grpc.WithUnaryInterceptor(RetryUnaryClientInterceptor(
+		WithRetryMethods(testUnaryMethod),
+		WithRetryBackoff(time.Millisecond, time.Millisecond),
+	)))
+
+	start := time.Now()
+	if err := conn.Invoke(context.Background(), testUnaryMethod, wrapperspb.String("v"), new(wrapperspb.StringValue)); err != nil {
+		t.Fatalf("Invoke() error = %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want the retry-after header of 1s", elapsed)
+	}
+
+	// a deadline shorter than retry-after ends the wait
+	atomic.StoreInt32(&calls, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := conn.Invoke(ctx, testUnaryMethod, wrapperspb.String("v"), new(wrapperspb.StringValue))
+	if got := status.Code(err); got != codes.DeadlineExceeded {
+		t.Errorf("Invoke() with deadline code = %v, want %v", got, codes.DeadlineExceeded)
+	}
+}
+
+func TestRetryStreamClientInterceptor(t *testing.T) {
+	tests := []struct {
+		name      string
+		callOpts  []grpc.CallOption
+		wantOpens int32
+		wantCode  codes.Code
+	}{
+		{name: "not idempotent", wantOpens: 1, wantCode: codes.Unavailable},
+		{name: "idempotent", callOpts: []grpc.CallOption{Idempotent()}, wantOpens: 3, wantCode: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opens int32
+			// fails to open the first two streams, like an unreachable server
+			unavailable := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+				if atomic.AddInt32(&opens, 1) <= 2 {
+					return nil, status.Error(codes.Unavailable, "unavailable")
+				}
+				return streamer(ctx, desc, cc, method, opts...)
+			}
+
+			conn := newTestConn(t, echo(), nil, grpc.WithChainStreamInterceptor(
+				RetryStreamClientInterceptor(WithRetryBackoff(time.Millisecond, time.Millisecond)),
+				unavailable,
+			))
+
+			cs, err := conn.NewStream(context.Background(), testStreamDesc, testStreamMethod, tt.callOpts...)
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("NewStream() code = %v, want %v", got, tt.wantCode)
+			}
+
+			if opens != tt.wantOpens {
+				t.Errorf("stream opened %v times, want %v", opens, tt.wantOpens)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if err := cs.SendMsg(wrapperspb.String("v")); err != nil {
+				t.Fatalf("SendMsg() error = %v", err)
+			}
+			if err := cs.RecvMsg(new(wrapperspb.StringValue)); err != nil {
+				t.Errorf("RecvMsg() error = %v", err)
+			}
+			_ = cs.CloseSend()
+		})
+	}
+}
+
+func TestLogStreamClientInterceptor(t *testing.T) {
+	tests := []struct {
+		name      string
+		desc      *grpc.StreamDesc
+		fail      bool
+		wantLevel string
+	}{
+		{name: "bidi", desc: testStreamDesc, wantLevel: "info"},
+		{name: "client streaming", desc: &grpc.StreamDesc{StreamName: "Stream", ClientStreams: true}, wantLevel: "info"},
+		{name: "failed", desc: testStreamDesc, fail: true, wantLevel: "error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, logs := newObservedLogger()
+
+			ts := echo()
+			if tt.fail {
+				ts.stream = func(grpc.ServerStream) error {
+					return status.Error(codes.Internal, "failed")
+				}
+			}
+
+			conn := newTestConn(t, ts, nil, grpc.WithStreamInterceptor(LogStreamClientInterceptor(logger)))
+			cs, err := conn.NewStream(context.Background(), tt.desc, testStreamMethod)
+			if err != nil {
+				t.Fatalf("NewStream() error = %v", err)
+			}
+
+			_ = cs.SendMsg(wrapperspb.String("v"))
+			_ = cs.CloseSend()
+			if !tt.fail && logs.Len() != 0 {
+				t.Errorf("logged %v lines before the stream ended", logs.Len())
+			}
+
+			// reading past the end reports the final status again
+			for i := 0; i < 3; i++ {
+				_ = cs.RecvMsg(new(wrapperspb.StringValue))
+			}
+
+			entries := logs.AllUntimed()
+			if len(entries) != 1 {
+				t.Fatalf("logged %v lines, want 1", len(entries))
+			}
+
+			if entries[0].Message != testStreamMethod || entries[0].Level.String() != tt.wantLevel {
+				t.Errorf("logged %v %v, want %v %v", entries[0].Level, entries[0].Message, tt.wantLevel, testStreamMethod)
+			}
+		})
+	}
+}
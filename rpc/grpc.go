@@ -16,7 +16,6 @@ import (
 	"github.com/sunary/kitchen/l"
 	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/grpclog"
 	"google.golang.org/grpc/status"
 )
@@ -28,31 +27,70 @@ func init() {
 	runtime.HTTPError = DefaultHTTPError
 }
 
-// ValidateInterceptor returns middleware for validate
-func ValidateInterceptor() grpc.UnaryServerInterceptor {
+// LogUnaryServerInterceptor returns middleware for logging with zap, panics are recovered as codes.Internal.
+// Errors in excepts are logged as warnings.
+func LogUnaryServerInterceptor(logger l.Logger, excepts ...error) grpc.UnaryServerInterceptor {
+	getLogFn := newLogFn(excepts)
+
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
-		type validate interface {
-			Validate() error
-		}
+		logger := logger.Ctx(ctx)
+		start := time.Now()
+		defer func() {
+			t := time.Now().Sub(start)
 
-		val := req.(validate)
-		if err := val.Validate(); err != nil {
-			return nil, e.Error(e.Code(codes.FailedPrecondition), "Invalid parameters", err)
-		}
+			if r := recover(); r != nil {
+				err = recoverPanic(logger, info.FullMethod, r, nil)
+			}
+
+			if err == nil {
+				logFn := getLogFn(logger, resp)
+				logFn(info.FullMethod, l.Duration("t", t), l.Interface("\n→", req), l.Interface("\n⇐", resp))
+				return
+			}
+
+			getLogFn(logger, err)(info.FullMethod, l.Duration("t", t), l.Interface("\n→", req), errorField(err))
+		}()
 
 		return handler(ctx, req)
 	}
 }
 
-// LogUnaryServerInterceptor returns middleware for logging with zap
-func LogUnaryServerInterceptor(logger l.Logger, excepts ...error) grpc.UnaryServerInterceptor {
+// LogStreamServerInterceptor returns stream middleware for logging with zap, see LogUnaryServerInterceptor
+func LogStreamServerInterceptor(logger l.Logger, excepts ...error) grpc.StreamServerInterceptor {
+	getLogFn := newLogFn(excepts)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		logger := logger.Ctx(ss.Context())
+		start := time.Now()
+		defer func() {
+			t := time.Now().Sub(start)
+
+			if r := recover(); r != nil {
+				err = recoverPanic(logger, info.FullMethod, r, nil)
+			}
+
+			if err == nil {
+				logger.Info(info.FullMethod, l.Duration("t", t))
+				return
+			}
+
+			getLogFn(logger, err)(info.FullMethod, l.Duration("t", t), errorField(err))
+		}()
+
+		return handler(srv, ss)
+	}
+}
+
+// newLogFn returns the log level of a response or error, errors in excepts are warnings
+func newLogFn(excepts []error) func(logger l.Logger, v interface{}) func(msg string, fields ...zapcore.Field) {
 	m := make(map[error]struct{})
 	for _, err := range excepts {
 		m[err] = struct{}{}
 	}
 
-	getLogFn := func(v interface{}) (lg func(msg string, fields ...zapcore.Field)) {
+	return func(logger l.Logger, v interface{}) (lg func(msg string, fields ...zapcore.Field)) {
 		if err, ok := v.(error); ok {
+			// unhashable errors can not be looked up
 			defer func() {
 				if e := recover(); e != nil {
 					lg = logger.Error
@@ -68,36 +106,15 @@ func LogUnaryServerInterceptor(logger l.Logger, excepts ...error) grpc.UnaryServ
 
 		return logger.Info
 	}
+}
 
-	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
-		start := time.Now()
-		defer func() {
-			t := time.Now().Sub(start)
-
-			e := recover()
-			if e != nil {
-				logger.Error("Panic (Recovered)", l.Error(err), l.Stack())
-				err = status.Errorf(codes.Internal, "Internal Error (%v)", e)
-			}
-
-			if err == nil {
-				logFn := getLogFn(resp)
-				logFn(info.FullMethod, l.Duration("t", t), l.Interface("\n→", req), l.Interface("\n⇐", resp))
-				return
-			}
-
-			logFn := getLogFn(err)
-
-			// Append details
-			if errorStatus, ok := status.FromError(err); ok {
-				logFn(info.FullMethod, l.Duration("t", t), l.Interface("\n→", req), l.Stringer("\n⇐ERROR", errorStatus.Proto()))
-			} else {
-				logFn(info.FullMethod, l.Duration("t", t), l.Interface("\n→", req), l.String("\n⇐ERROR", err.Error()))
-			}
-		}()
-
-		return handler(ctx, req)
+// errorField appends details of err
+func errorField(err error) zapcore.Field {
+	if errorStatus, ok := status.FromError(err); ok {
+		return l.Stringer("\n⇐ERROR", errorStatus.Proto())
 	}
+
+	return l.String("\n⇐ERROR", err.Error())
 }
 
 // DefaultHTTPError is extracted from grpc package
@@ -0,0 +1,101 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	testUnaryMethod  = "/test.Echo/Unary"
+	testStreamMethod = "/test.Echo/Stream"
+)
+
+var testStreamDesc = &grpc.StreamDesc{StreamName: "Stream", ServerStreams: true, ClientStreams: true}
+
+// testServer handles the unary and bidi stream methods of the test.Echo service
+type testServer struct {
+	unary  func(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error)
+	stream func(ss grpc.ServerStream) error
+}
+
+// echo replies with the request, then the stream echoes messages until the client closes it
+func echo() testServer {
+	return testServer{
+		unary: func(_ context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+			return req, nil
+		},
+		stream: func(ss grpc.ServerStream) error {
+			for {
+				m := new(wrapperspb.StringValue)
+				if err := ss.RecvMsg(m); err != nil {
+					return nil
+				}
+				if err := ss.SendMsg(m); err != nil {
+					return err
+				}
+			}
+		},
+	}
+}
+
+func (ts testServer) desc() *grpc.ServiceDesc {
+	return &grpc.ServiceDesc{
+		ServiceName: "test.Echo",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Unary",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := new(wrapperspb.StringValue)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return ts.unary(ctx, req.(*wrapperspb.StringValue))
+				}
+				if interceptor == nil {
+					return handler(ctx, req)
+				}
+
+				return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: testUnaryMethod}, handler)
+			},
+		}},
+		Streams: []grpc.StreamDesc{{
+			StreamName:    testStreamDesc.StreamName,
+			ServerStreams: true,
+			ClientStreams: true,
+			Handler: func(_ interface{}, ss grpc.ServerStream) error {
+				return ts.stream(ss)
+			},
+		}},
+	}
+}
+
+// newTestConn serves ts over an in-memory listener and returns a client connection to it
+func newTestConn(t *testing.T, ts testServer, serverOpts []grpc.ServerOption, dialOpts ...grpc.DialOption) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(serverOpts...)
+	s.RegisterService(ts.desc(), struct{}{})
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	dialOpts = append(dialOpts,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	conn, err := grpc.DialContext(context.Background(), "bufnet", dialOpts...)
+	if err != nil {
+		t.Fatalf("DialContext() error = %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
@@ -0,0 +1,84 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/sunary/kitchen/e"
+	"github.com/sunary/kitchen/l"
+	"github.com/sunary/kitchen/rl"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// RateLimitKeyFunc returns the limiter key of a call
+type RateLimitKeyFunc func(ctx context.Context, fullMethod string) string
+
+// KeyByMethod limits each method across all clients
+func KeyByMethod(_ context.Context, fullMethod string) string {
+	return fullMethod
+}
+
+// KeyByPeer limits each method per client address
+func KeyByPeer(ctx context.Context, fullMethod string) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return fullMethod
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		host = p.Addr.String()
+	}
+
+	return fullMethod + ":" + host
+}
+
+// RateLimitUnaryServerInterceptor returns middleware rejecting calls over the limit with codes.ResourceExhausted.
+// key defaults to KeyByMethod. Limiter errors are logged and let calls through, so an unavailable redis does not stop the service.
+func RateLimitUnaryServerInterceptor(logger l.Logger, limiter rl.Limiter, key RateLimitKeyFunc) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		if err := rateLimit(ctx, logger, limiter, key, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// RateLimitStreamServerInterceptor returns stream middleware rejecting calls over the limit, see RateLimitUnaryServerInterceptor
+func RateLimitStreamServerInterceptor(logger l.Logger, limiter rl.Limiter, key RateLimitKeyFunc) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := rateLimit(ss.Context(), logger, limiter, key, info.FullMethod); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+func rateLimit(ctx context.Context, logger l.Logger, limiter rl.Limiter, key RateLimitKeyFunc, fullMethod string) error {
+	if key == nil {
+		key = KeyByMethod
+	}
+
+	res, err := limiter.Allow(key(ctx, fullMethod))
+	if err != nil {
+		logger.Ctx(ctx).Warn("rate limit failed, call allowed", l.String("method", fullMethod), l.Error(err))
+		return nil
+	}
+
+	if res.Allowed {
+		return nil
+	}
+
+	// forwarded by the gateway as Grpc-Metadata-Retry-After
+	retryAfter := (res.RetryAfter + time.Second - 1) / time.Second
+	_ = grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.FormatInt(int64(retryAfter), 10)))
+
+	return e.Error(e.Code(codes.ResourceExhausted), "Too many requests")
+}
@@ -0,0 +1,65 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sunary/kitchen/l"
+	"github.com/sunary/kitchen/rl"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeLimiter struct {
+	res rl.Result
+	err error
+}
+
+func (f fakeLimiter) Allow(key string) (rl.Result, error) {
+	return f.AllowN(key, 1)
+}
+
+func (f fakeLimiter) AllowN(string, int64) (rl.Result, error) {
+	return f.res, f.err
+}
+
+func (f fakeLimiter) Reset(string) error {
+	return nil
+}
+
+func newObservedLogger() (l.Logger, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	return l.Logger{Logger: zap.New(core)}, logs
+}
+
+func TestRateLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		limiter  fakeLimiter
+		wantCode codes.Code
+		wantLogs int
+	}{
+		{name: "allowed", limiter: fakeLimiter{res: rl.Result{Allowed: true}}, wantCode: codes.OK},
+		{name: "denied", limiter: fakeLimiter{res: rl.Result{RetryAfter: 1500 * time.Millisecond}}, wantCode: codes.ResourceExhausted},
+		{name: "limiter error", limiter: fakeLimiter{err: errors.New("redis down")}, wantCode: codes.OK, wantLogs: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, logs := newObservedLogger()
+
+			err := rateLimit(context.Background(), logger, tt.limiter, nil, "/svc/Method")
+			if got := status.Code(err); got != tt.wantCode {
+				t.Errorf("rateLimit() code = %v, want %v", got, tt.wantCode)
+			}
+
+			if logs.Len() != tt.wantLogs {
+				t.Errorf("rateLimit() logged %v lines, want %v", logs.Len(), tt.wantLogs)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sunary/kitchen/e"
+	"github.com/sunary/kitchen/l"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// RecoveryUnaryServerInterceptor returns middleware converting panics of handlers to codes.Internal.
+// Panics are logged with stack, then handlers are called with the recovered value like rt.HandleCrash.
+func RecoveryUnaryServerInterceptor(logger l.Logger, handlers ...func(interface{})) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recoverPanic(logger.Ctx(ctx), info.FullMethod, r, handlers)
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// RecoveryStreamServerInterceptor returns stream middleware converting panics to codes.Internal, see RecoveryUnaryServerInterceptor
+func RecoveryStreamServerInterceptor(logger l.Logger, handlers ...func(interface{})) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recoverPanic(logger.Ctx(ss.Context()), info.FullMethod, r, handlers)
+			}
+		}()
+
+		return handler(srv, ss)
+	}
+}
+
+// recoverPanic logs the recovered value r of a panic in method, calls handlers and returns the status of the call
+func recoverPanic(logger l.Logger, method string, r interface{}, handlers []func(interface{})) error {
+	logger.Error("Panic (Recovered)", l.String("method", method), l.Object("e", r), l.Stack())
+
+	for _, fn := range handlers {
+		fn(r)
+	}
+
+	return e.Error(e.Code(codes.Internal), fmt.Sprintf("Internal Error (%v)", r))
+}
@@ -0,0 +1,111 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestRecoveryServerInterceptor(t *testing.T) {
+	logger, logs := newObservedLogger()
+
+	var recovered []interface{}
+	handler := func(r interface{}) {
+		recovered = append(recovered, r)
+	}
+
+	ts := testServer{
+		unary: func(context.Context, *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+			panic("unary")
+		},
+		stream: func(grpc.ServerStream) error {
+			panic("stream")
+		},
+	}
+	conn := newTestConn(t, ts, []grpc.ServerOption{
+		grpc.UnaryInterceptor(RecoveryUnaryServerInterceptor(logger, handler)),
+		grpc.StreamInterceptor(RecoveryStreamServerInterceptor(logger, handler)),
+	})
+
+	ctx := context.Background()
+	err := conn.Invoke(ctx, testUnaryMethod, wrapperspb.String("v"), new(wrapperspb.StringValue))
+	if s := status.Convert(err); s.Code() != codes.Internal || s.Message() != "Internal Error (unary)" {
+		t.Errorf("Invoke() error = %v, want Internal Error (unary)", err)
+	}
+
+	cs, err := conn.NewStream(ctx, testStreamDesc, testStreamMethod)
+	if err != nil {
+		t.Fatalf("NewStream() error = %v", err)
+	}
+	_ = cs.CloseSend()
+
+	err = cs.RecvMsg(new(wrapperspb.StringValue))
+	if s := status.Convert(err); s.Code() != codes.Internal || s.Message() != "Internal Error (stream)" {
+		t.Errorf("RecvMsg() error = %v, want Internal Error (stream)", err)
+	}
+
+	if len(recovered) != 2 || recovered[0] != "unary" || recovered[1] != "stream" {
+		t.Errorf("handlers called with %v, want [unary stream]", recovered)
+	}
+
+	entries := logs.AllUntimed()
+	if len(entries) != 2 {
+		t.Fatalf("logged %v lines, want 2", len(entries))
+	}
+
+	for i, method := range []string{testUnaryMethod, testStreamMethod} {
+		if got := entries[i].ContextMap()["method"]; got != method {
+			t.Errorf("line %v method = %v, want %v", i, got, method)
+		}
+	}
+}
+
+func TestLogServerInterceptor(t *testing.T) {
+	logger, logs := newObservedLogger()
+
+	ts := echo()
+	ts.unary = func(_ context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+		if req.Value == "fail" {
+			return nil, status.Error(codes.NotFound, "not found")
+		}
+		return req, nil
+	}
+
+	conn := newTestConn(t, ts, []grpc.ServerOption{
+		grpc.UnaryInterceptor(LogUnaryServerInterceptor(logger)),
+		grpc.StreamInterceptor(LogStreamServerInterceptor(logger)),
+	})
+
+	ctx := context.Background()
+	_ = conn.Invoke(ctx, testUnaryMethod, wrapperspb.String("ok"), new(wrapperspb.StringValue))
+	_ = conn.Invoke(ctx, testUnaryMethod, wrapperspb.String("fail"), new(wrapperspb.StringValue))
+
+	cs, err := conn.NewStream(ctx, testStreamDesc, testStreamMethod)
+	if err != nil {
+		t.Fatalf("NewStream() error = %v", err)
+	}
+	_ = cs.CloseSend()
+	_ = cs.RecvMsg(new(wrapperspb.StringValue))
+
+	entries := logs.AllUntimed()
+	if len(entries) != 3 {
+		t.Fatalf("logged %v lines, want 3", len(entries))
+	}
+
+	for i, want := range []struct {
+		method string
+		level  string
+	}{
+		{testUnaryMethod, "info"},
+		{testUnaryMethod, "error"},
+		{testStreamMethod, "info"},
+	} {
+		if entries[i].Message != want.method || entries[i].Level.String() != want.level {
+			t.Errorf("line %v = %v %v, want %v %v", i, entries[i].Level, entries[i].Message, want.level, want.method)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"net/textproto"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/sunary/kitchen/id"
+	"github.com/sunary/kitchen/l"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDHeader is the metadata key and http header carrying request ids
+const RequestIDHeader = "x-request-id"
+
+// maxRequestIDLen bounds incoming request ids, longer ones are replaced
+const maxRequestIDLen = 128
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the request id stored in ctx, empty when there is none
+func RequestIDFromContext(ctx context.Context) string {
+	rid, _ := ctx.Value(requestIDKey{}).(string)
+	return rid
+}
+
+// WithRequestID stores rid in ctx, attaches it to log lines of l.Logger.Ctx and the *Ctx log methods,
+// and to outgoing metadata of calls made with ctx. It replaces the request id already in ctx.
+func WithRequestID(ctx context.Context, rid string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, rid)
+	ctx = l.WithFields(ctx, l.String("request_id", rid))
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	md.Set(RequestIDHeader, rid)
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// validRequestID accepts ids of letters, digits and -_.: up to maxRequestIDLen, so clients can not inject into logs
+func validRequestID(rid string) bool {
+	if rid == "" || len(rid) > maxRequestIDLen {
+		return false
+	}
+
+	for _, c := range rid {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// RequestIDUnaryServerInterceptor returns middleware reading the request id from incoming metadata, or generating one
+// when it is missing or invalid, see WithRequestID. The id is echoed in response headers. Chain it before logging interceptors.
+func RequestIDUnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		return handler(incomingRequestID(ctx), req)
+	}
+}
+
+// RequestIDStreamServerInterceptor returns stream middleware for request ids, see RequestIDUnaryServerInterceptor
+func RequestIDStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &contextStream{ServerStream: ss, ctx: incomingRequestID(ss.Context())})
+	}
+}
+
+// RequestIDUnaryClientInterceptor returns client middleware sending a new request id with calls whose ctx has none
+func RequestIDUnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoingRequestID(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// RequestIDStreamClientInterceptor returns stream client middleware for request ids, see RequestIDUnaryClientInterceptor
+func RequestIDStreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoingRequestID(ctx), desc, cc, method, opts...)
+	}
+}
+
+// RequestIDHeaderMatcher forwards the X-Request-Id http header to grpc metadata, other headers as runtime.DefaultHeaderMatcher.
+// Use it with runtime.WithIncomingHeaderMatcher.
+func RequestIDHeaderMatcher(key string) (string, bool) {
+	if textproto.CanonicalMIMEHeaderKey(key) == textproto.CanonicalMIMEHeaderKey(RequestIDHeader) {
+		return RequestIDHeader, true
+	}
+
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+// RequestIDHandler wraps a gateway handler, generating the X-Request-Id header of requests without a valid one
+// and echoing it in responses, errors included. The mux must forward it with RequestIDHeaderMatcher.
+func RequestIDHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rid := r.Header.Get(RequestIDHeader)
+		if !validRequestID(rid) {
+			rid = id.NewUUID().String()
+			r.Header.Set(RequestIDHeader, rid)
+		}
+
+		w.Header().Set(RequestIDHeader, rid)
+		h.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), rid)))
+	})
+}
+
+func incomingRequestID(ctx context.Context) context.Context {
+	var rid string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDHeader); len(values) > 0 {
+			rid = values[0]
+		}
+	}
+
+	if !validRequestID(rid) {
+		rid = id.NewUUID().String()
+	}
+
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, rid))
+	return WithRequestID(ctx, rid)
+}
+
+func outgoingRequestID(ctx context.Context) context.Context {
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(RequestIDHeader)) > 0 {
+		return ctx
+	}
+
+	rid := RequestIDFromContext(ctx)
+	if rid == "" {
+		return WithRequestID(ctx, id.NewUUID().String())
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, RequestIDHeader, rid)
+}
+
+// contextStream replaces the context of a server stream
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,194 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sunary/kitchen/l"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestRequestIDServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name string
+		rid  string
+		want string
+	}{
+		{name: "read", rid: "req-1.a:b_c", want: "req-1.a:b_c"},
+		{name: "generated"},
+		{name: "too long", rid: strings.Repeat("a", maxRequestIDLen+1)},
+		{name: "invalid characters", rid: "id with spaces"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, logs := newObservedLogger()
+
+			var seen string
+			ts := echo()
+			ts.unary = func(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+				seen = RequestIDFromContext(ctx)
+				logger.InfoCtx(ctx, "handled")
+				return req, nil
+			}
+
+			conn := newTestConn(t, ts, []grpc.ServerOption{
+				grpc.ChainUnaryInterceptor(RequestIDUnaryServerInterceptor(), LogUnaryServerInterceptor(logger)),
+			})
+
+			ctx := context.Background()
+			if tt.rid != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, RequestIDHeader, tt.rid)
+			}
+
+			var header metadata.MD
+			if err := conn.Invoke(ctx, testUnaryMethod, wrapperspb.String("v"), new(wrapperspb.StringValue), grpc.Header(&header)); err != nil {
+				t.Fatalf("Invoke() error = %v", err)
+			}
+
+			if tt.want != "" && seen != tt.want {
+				t.Errorf("request id = %q, want %q", seen, tt.want)
+			}
+			if tt.want == "" && (seen == "" || seen == tt.rid) {
+				t.Errorf("request id = %q, want a generated one", seen)
+			}
+
+			if got := header.Get(RequestIDHeader); len(got) != 1 || got[0] != seen {
+				t.Errorf("echoed request id = %v, want %v", got, seen)
+			}
+
+			// both the handler line and the interceptor line carry the id once
+			entries := logs.AllUntimed()
+			if len(entries) != 2 {
+				t.Fatalf("logged %v lines, want 2", len(entries))
+			}
+			for _, entry := range entries {
+				n := 0
+				for _, f := range entry.Context {
+					if f.Key == "request_id" && f.String == seen {
+						n++
+					}
+				}
+				if n != 1 {
+					t.Errorf("%q has %v request ids, want 1: %v", entry.Message, n, entry.Context)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestIDStreamServerInterceptor(t *testing.T) {
+	var seen string
+	ts := echo()
+	ts.stream = func(ss grpc.ServerStream) error {
+		seen = RequestIDFromContext(ss.Context())
+		return nil
+	}
+
+	conn := newTestConn(t, ts, []grpc.ServerOption{grpc.StreamInterceptor(RequestIDStreamServerInterceptor())})
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), RequestIDHeader, "stream-1")
+	cs, err := conn.NewStream(ctx, testStreamDesc, testStreamMethod)
+	if err != nil {
+		t.Fatalf("NewStream() error = %v", err)
+	}
+	_ = cs.CloseSend()
+	_ = cs.RecvMsg(new(wrapperspb.StringValue))
+
+	if seen != "stream-1" {
+		t.Errorf("request id = %q, want stream-1", seen)
+	}
+
+	if header, _ := cs.Header(); len(header.Get(RequestIDHeader)) != 1 || header.Get(RequestIDHeader)[0] != "stream-1" {
+		t.Errorf("echoed request id = %v, want stream-1", header.Get(RequestIDHeader))
+	}
+}
+
+func TestRequestIDClientInterceptor(t *testing.T) {
+	var seen []string
+	ts := echo()
+	ts.unary = func(ctx context.Context, req *wrapperspb.StringValue) (*wrapperspb.StringValue, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		seen = md.Get(RequestIDHeader)
+		return req, nil
+	}
+
+	conn := newTestConn(t, ts, nil, grpc.WithUnaryInterceptor(RequestIDUnaryClientInterceptor()))
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{name: "generated", ctx: context.Background()},
+		{name: "from context", ctx: WithRequestID(context.Background(), "req-1"), want: "req-1"},
+		{name: "nested", ctx: WithRequestID(WithRequestID(context.Background(), "outer"), "inner"), want: "inner"},
+	}
+	for _, tt := range tests {
+		if err := conn.Invoke(tt.ctx, testUnaryMethod, wrapperspb.String("v"), new(wrapperspb.StringValue)); err != nil {
+			t.Fatalf("%v: Invoke() error = %v", tt.name, err)
+		}
+
+		if len(seen) != 1 || seen[0] == "" || (tt.want != "" && seen[0] != tt.want) {
+			t.Errorf("%v: server got request ids %v, want one %q", tt.name, seen, tt.want)
+		}
+	}
+}
+
+func TestWithRequestID_Nested(t *testing.T) {
+	ctx := l.WithFields(context.Background(), l.String("user", "u1"))
+	ctx = WithRequestID(WithRequestID(ctx, "outer"), "inner")
+
+	fields := l.Fields(ctx)
+	if len(fields) != 2 || fields[0].Key != "user" || fields[1].Key != "request_id" || fields[1].String != "inner" {
+		t.Errorf("fields = %v, want user and the inner request_id", fields)
+	}
+
+	if got := RequestIDFromContext(ctx); got != "inner" {
+		t.Errorf("RequestIDFromContext() = %q, want inner", got)
+	}
+}
+
+func TestRequestIDHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		rid  string
+		want string
+	}{
+		{name: "read", rid: "req-1", want: "req-1"},
+		{name: "generated"},
+		{name: "invalid", rid: "bad\tid"},
+		{name: "too long", rid: strings.Repeat("a", maxRequestIDLen+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen, forwarded string
+			h := RequestIDHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = RequestIDFromContext(r.Context())
+				forwarded = r.Header.Get(RequestIDHeader)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.rid != "" {
+				r.Header.Set(RequestIDHeader, tt.rid)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if tt.want != "" && seen != tt.want {
+				t.Errorf("request id = %q, want %q", seen, tt.want)
+			}
+			if tt.want == "" && (seen == "" || seen == tt.rid) {
+				t.Errorf("request id = %q, want a generated one", seen)
+			}
+
+			if forwarded != seen || w.Header().Get(RequestIDHeader) != seen {
+				t.Errorf("forwarded %q and echoed %q, want %q", forwarded, w.Header().Get(RequestIDHeader), seen)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sunary/kitchen/e"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// validators of requests, checked in this order
+type (
+	contextValidator interface {
+		ValidateContext(ctx context.Context) error
+	}
+
+	allValidator interface {
+		ValidateAll() error
+	}
+
+	validator interface {
+		Validate() error
+	}
+)
+
+// fieldError is implemented by protoc-gen-validate errors
+type fieldError interface {
+	Field() string
+	Reason() string
+}
+
+// ValidateInterceptor returns middleware rejecting invalid requests with codes.InvalidArgument and errdetails.BadRequest.
+// Requests are validated by ValidateContext(ctx), ValidateAll() or Validate(), requests without them are passed through.
+func ValidateInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+		if err := validate(ctx, req); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// ValidateStreamServerInterceptor returns stream middleware validating each received message, see ValidateInterceptor
+func ValidateStreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &validatingStream{ss})
+	}
+}
+
+type validatingStream struct {
+	grpc.ServerStream
+}
+
+func (s *validatingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	return validate(s.Context(), m)
+}
+
+func validate(ctx context.Context, req interface{}) error {
+	var err error
+	switch v := req.(type) {
+	case contextValidator:
+		err = v.ValidateContext(ctx)
+	case allValidator:
+		err = v.ValidateAll()
+	case validator:
+		err = v.Validate()
+	}
+
+	if err == nil {
+		return nil
+	}
+
+	return e.ErrorWithDetails(e.Code(codes.InvalidArgument), "Invalid parameters", &errdetails.BadRequest{
+		FieldViolations: fieldViolations("", err, nil),
+	})
+}
+
+// fieldViolations flattens multi errors of err and the errors of embedded messages, nested by Cause, under their field path.
+// A field error wrapped with %w keeps its field.
+func fieldViolations(path string, err error, violations []*errdetails.BadRequest_FieldViolation) []*errdetails.BadRequest_FieldViolation {
+	var errs []error
+	switch v := err.(type) {
+	case interface{ AllErrors() []error }:
+		errs = v.AllErrors()
+	case interface{ Unwrap() []error }:
+		errs = v.Unwrap()
+	default:
+		var fe fieldError
+		if !errors.As(err, &fe) {
+			return append(violations, &errdetails.BadRequest_FieldViolation{
+				Field:       path,
+				Description: err.Error(),
+			})
+		}
+
+		if path != "" {
+			path += "."
+		}
+		path += fe.Field()
+
+		if c, ok := fe.(interface{ Cause() error }); ok && isNested(c.Cause()) {
+			return fieldViolations(path, c.Cause(), violations)
+		}
+
+		return append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       path,
+			Description: fe.Reason(),
+		})
+	}
+
+	for _, err := range errs {
+		violations = fieldViolations(path, err, violations)
+	}
+
+	return violations
+}
+
+func isNested(err error) bool {
+	switch err.(type) {
+	case interface{ AllErrors() []error }, interface{ Unwrap() []error }:
+		return true
+	}
+
+	var fe fieldError
+	return errors.As(err, &fe)
+}
@@ -0,0 +1,202 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// testFieldError mimics the errors generated by protoc-gen-validate
+type testFieldError struct {
+	field  string
+	reason string
+	cause  error
+}
+
+func (e testFieldError) Field() string  { return e.field }
+func (e testFieldError) Reason() string { return e.reason }
+func (e testFieldError) Cause() error   { return e.cause }
+func (e testFieldError) Error() string  { return "invalid " + e.field + ": " + e.reason }
+
+// testMultiError mimics the multi errors of ValidateAll
+type testMultiError []error
+
+func (m testMultiError) Error() string {
+	msgs := make([]string, len(m))
+	for i, err := range m {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (m testMultiError) AllErrors() []error { return m }
+
+func TestFieldViolations(t *testing.T) {
+	name := testFieldError{field: "name", reason: "required"}
+	age := testFieldError{field: "age", reason: "must be positive"}
+
+	tests := []struct {
+		name string
+		err  error
+		want map[string]string
+	}{
+		{name: "plain error", err: errors.New("bad"), want: map[string]string{"": "bad"}},
+		{name: "field error", err: name, want: map[string]string{"name": "required"}},
+		{name: "wrapped field error", err: fmt.Errorf("create user: %w", name), want: map[string]string{"name": "required"}},
+		{name: "all errors", err: testMultiError{name, age}, want: map[string]string{"name": "required", "age": "must be positive"}},
+		{name: "joined errors", err: errors.Join(name, fmt.Errorf("wrapped: %w", age)), want: map[string]string{"name": "required", "age": "must be positive"}},
+		{
+			name: "nested message",
+			err: testFieldError{field: "address", reason: "embedded message failed validation", cause: testMultiError{
+				testFieldError{field: "city", reason: "required"},
+				testFieldError{field: "geo", reason: "embedded message failed validation", cause: fmt.Errorf("geo: %w", testFieldError{field: "lat", reason: "out of range"})},
+			}},
+			want: map[string]string{"address.city": "required", "address.geo.lat": "out of range"},
+		},
+		{
+			name: "cause not nested",
+			err:  testFieldError{field: "email", reason: "invalid email", cause: errors.New("missing @")},
+			want: map[string]string{"email": "invalid email"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := make(map[string]string)
+			for _, v := range fieldViolations("", tt.err, nil) {
+				got[v.Field] = v.Description
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fieldViolations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// allRequest records which validator was called, contextRequest has all of them
+type allRequest struct{ called *string }
+
+func (r allRequest) record(name string) error {
+	*r.called = name
+	return nil
+}
+
+func (r allRequest) ValidateAll() error { return r.record("ValidateAll") }
+func (r allRequest) Validate() error    { return r.record("Validate") }
+
+type contextRequest struct{ allRequest }
+
+func (r contextRequest) ValidateContext(context.Context) error { return r.record("ValidateContext") }
+
+func TestValidate_Order(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		req  func(called *string) interface{}
+		want string
+	}{
+		{name: "context", req: func(c *string) interface{} { return contextRequest{allRequest{c}} }, want: "ValidateContext"},
+		{name: "all", req: func(c *string) interface{} { return allRequest{c} }, want: "ValidateAll"},
+		{name: "none", req: func(*string) interface{} { return struct{}{} }},
+	} {
+		var called string
+		if err := validate(context.Background(), tt.req(&called)); err != nil || called != tt.want {
+			t.Errorf("%v: validate() called %q, %v, want %q", tt.name, called, err, tt.want)
+		}
+	}
+}
+
+// validatedString rejects empty values, it unmarshals into the embedded message
+type validatedString struct {
+	*wrapperspb.StringValue
+}
+
+func (v validatedString) Validate() error {
+	if v.Value == "" {
+		return testFieldError{field: "value", reason: "required"}
+	}
+	return nil
+}
+
+func wantBadRequest(t *testing.T, err error, field string) {
+	t.Helper()
+
+	s := status.Convert(err)
+	if s.Code() != codes.InvalidArgument {
+		t.Fatalf("error = %v, want %v", err, codes.InvalidArgument)
+	}
+
+	details := s.Details()
+	if len(details) != 1 {
+		t.Fatalf("details = %v, want a BadRequest", details)
+	}
+
+	br, ok := details[0].(*errdetails.BadRequest)
+	if !ok || len(br.FieldViolations) != 1 || br.FieldViolations[0].Field != field {
+		t.Errorf("details = %v, want a violation of %v", details[0], field)
+	}
+}
+
+func TestValidateInterceptor(t *testing.T) {
+	ts := echo()
+	ts.stream = func(ss grpc.ServerStream) error {
+		m := validatedString{new(wrapperspb.StringValue)}
+		if err := ss.RecvMsg(m); err != nil {
+			return err
+		}
+		return ss.SendMsg(m.StringValue)
+	}
+
+	// the test service decodes requests as wrapperspb.StringValue, validate them as validatedString
+	validateString := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return ValidateInterceptor()(ctx, validatedString{req.(*wrapperspb.StringValue)}, info, func(ctx context.Context, _ interface{}) (interface{}, error) {
+			return handler(ctx, req)
+		})
+	}
+
+	conn := newTestConn(t, ts, []grpc.ServerOption{
+		grpc.UnaryInterceptor(validateString),
+		grpc.StreamInterceptor(ValidateStreamServerInterceptor()),
+	})
+
+	ctx := context.Background()
+	if err := conn.Invoke(ctx, testUnaryMethod, wrapperspb.String("v"), new(wrapperspb.StringValue)); err != nil {
+		t.Errorf("Invoke() valid error = %v", err)
+	}
+
+	err := conn.Invoke(ctx, testUnaryMethod, wrapperspb.String(""), new(wrapperspb.StringValue))
+	wantBadRequest(t, err, "value")
+
+	for _, tt := range []struct {
+		value   string
+		wantErr bool
+	}{
+		{value: "v"},
+		{value: "", wantErr: true},
+	} {
+		cs, err := conn.NewStream(ctx, testStreamDesc, testStreamMethod)
+		if err != nil {
+			t.Fatalf("NewStream() error = %v", err)
+		}
+
+		_ = cs.SendMsg(wrapperspb.String(tt.value))
+		err = cs.RecvMsg(new(wrapperspb.StringValue))
+		if !tt.wantErr {
+			if err != nil {
+				t.Errorf("RecvMsg() valid error = %v", err)
+			}
+			_ = cs.CloseSend()
+			continue
+		}
+
+		wantBadRequest(t, err, "value")
+	}
+}
@@ -0,0 +1,193 @@
+package wk
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBatcherClosed is returned when adding to a stopped batcher
+var ErrBatcherClosed = errors.New("wk: batcher is closed")
+
+// Batcher groups added items and flushes them to the executor
+// when size items are collected or maxLatency elapsed since the first one.
+type Batcher struct {
+	ctx        context.Context
+	size       int
+	maxLatency time.Duration
+	executor   func(context.Context, []interface{}) error
+	pool       *Pool
+
+	concurrency  int
+	taskOpts     []TaskOption
+	errorHandler func([]interface{}, error)
+
+	mu         sync.Mutex
+	items      []interface{}
+	timer      *time.Timer
+	generation uint64
+	closed     bool
+}
+
+// BatcherOption configures a batcher
+type BatcherOption func(*Batcher)
+
+// WithFlushConcurrency limits how many batches are flushed at the same time, default 1.
+// Add blocks while flushes are backed up.
+func WithFlushConcurrency(n int) BatcherOption {
+	return func(b *Batcher) {
+		b.concurrency = n
+	}
+}
+
+// WithFlushTaskOptions applies task options such as retries to each flush
+func WithFlushTaskOptions(opts ...TaskOption) BatcherOption {
+	return func(b *Batcher) {
+		b.taskOpts = append(b.taskOpts, opts...)
+	}
+}
+
+// WithBatchErrorHandler sets the callback of batches failed after all attempts,
+// and of batches flushed by maxLatency which could not be queued
+func WithBatchErrorHandler(fn func([]interface{}, error)) BatcherOption {
+	return func(b *Batcher) {
+		b.errorHandler = fn
+	}
+}
+
+// NewBatcher create new batcher
+func NewBatcher(ctx context.Context, size int, maxLatency time.Duration, executor func(context.Context, []interface{}) error, opts ...BatcherOption) *Batcher {
+	if size <= 0 {
+		size = 1
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	b := &Batcher{
+		ctx:         ctx,
+		size:        size,
+		maxLatency:  maxLatency,
+		executor:    executor,
+		concurrency: 1,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	b.pool = NewPool(ctx, b.concurrency)
+	return b
+}
+
+// Start flush workers
+func (b *Batcher) Start() {
+	b.pool.Start()
+}
+
+// Add an item to the current batch
+func (b *Batcher) Add(item interface{}) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBatcherClosed
+	}
+
+	b.items = append(b.items, item)
+	if len(b.items) == 1 && b.maxLatency > 0 {
+		gen := b.generation
+		b.timer = time.AfterFunc(b.maxLatency, func() {
+			b.flushGeneration(gen)
+		})
+	}
+
+	var batch []interface{}
+	if len(b.items) >= b.size {
+		batch = b.take()
+	}
+	b.mu.Unlock()
+
+	return b.flush(batch)
+}
+
+// Flush the current batch without waiting for it to be full
+func (b *Batcher) Flush() error {
+	b.mu.Lock()
+	batch := b.take()
+	b.mu.Unlock()
+
+	return b.flush(batch)
+}
+
+// Stop batcher. Flush the current batch and wait all flushes done.
+func (b *Batcher) Stop() {
+	_ = b.Shutdown(context.Background())
+}
+
+// Shutdown stops accepting items, flushes the current batch and waits for running flushes until ctx is done
+func (b *Batcher) Shutdown(ctx context.Context) error {
+	b.mu.Lock()
+	b.closed = true
+	batch := b.take()
+	b.mu.Unlock()
+
+	err := b.flush(batch)
+	if e := b.pool.Shutdown(ctx); e != nil {
+		return e
+	}
+
+	return err
+}
+
+func (b *Batcher) flushGeneration(gen uint64) {
+	b.mu.Lock()
+	var batch []interface{}
+	if gen == b.generation {
+		batch = b.take()
+	}
+	b.mu.Unlock()
+
+	// nobody waits for a timed flush, report it like a failed one
+	if err := b.flush(batch); err != nil && b.errorHandler != nil {
+		b.errorHandler(batch, err)
+	}
+}
+
+// take requires b.mu held
+func (b *Batcher) take() []interface{} {
+	if len(b.items) == 0 {
+		return nil
+	}
+
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+
+	batch := b.items
+	b.items = nil
+	b.generation++
+	return batch
+}
+
+func (b *Batcher) flush(batch []interface{}) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	t := NewTask(b.ctx, batch, func(ctx context.Context, info interface{}) error {
+		return b.executor(ctx, info.([]interface{}))
+	}, b.taskOpts...)
+
+	if b.errorHandler != nil {
+		t.onDone = func(r Result) {
+			if r.Err != nil {
+				b.errorHandler(batch, r.Err)
+			}
+		}
+	}
+
+	return b.pool.Do(t)
+}
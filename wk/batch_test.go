@@ -0,0 +1,151 @@
+package wk
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches [][]interface{}
+}
+
+func (r *batchRecorder) executor(_ context.Context, items []interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.batches = append(r.batches, items)
+	return nil
+}
+
+func (r *batchRecorder) sizes() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sizes := make([]int, len(r.batches))
+	for i := range r.batches {
+		sizes[i] = len(r.batches[i])
+	}
+
+	return sizes
+}
+
+func TestBatcher_Size(t *testing.T) {
+	r := &batchRecorder{}
+	b := NewBatcher(context.Background(), 3, time.Hour, r.executor)
+	b.Start()
+
+	for i := 0; i < 7; i++ {
+		if err := b.Add(i); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	b.Stop()
+
+	got := r.sizes()
+	if len(got) != 3 || got[0] != 3 || got[1] != 3 || got[2] != 1 {
+		t.Errorf("batch sizes = %v, want [3 3 1]", got)
+	}
+
+	if err := b.Add(8); err != ErrBatcherClosed {
+		t.Errorf("Add() after Stop error = %v, want %v", err, ErrBatcherClosed)
+	}
+}
+
+func TestBatcher_MaxLatency(t *testing.T) {
+	r := &batchRecorder{}
+	b := NewBatcher(context.Background(), 100, 20*time.Millisecond, r.executor)
+	b.Start()
+	defer b.Stop()
+
+	_ = b.Add(1)
+	_ = b.Add(2)
+
+	time.Sleep(5 * time.Millisecond)
+	if got := r.sizes(); len(got) != 0 {
+		t.Errorf("flushed %v before max latency", got)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(r.sizes()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := r.sizes(); len(got) != 1 || got[0] != 2 {
+		t.Errorf("batch sizes = %v, want [2]", got)
+	}
+}
+
+func TestBatcher_Concurrency(t *testing.T) {
+	var running, peak int32
+	b := NewBatcher(context.Background(), 1, 0, func(context.Context, []interface{}) error {
+		n := atomic.AddInt32(&running, 1)
+		if n > atomic.LoadInt32(&peak) {
+			atomic.StoreInt32(&peak, n)
+		}
+		time.Sleep(2 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	}, WithFlushConcurrency(2))
+	b.Start()
+
+	for i := 0; i < 20; i++ {
+		_ = b.Add(i)
+	}
+	b.Stop()
+
+	if got := atomic.LoadInt32(&peak); got > 2 {
+		t.Errorf("ran %v flushes concurrently, want at most 2", got)
+	}
+}
+
+func TestBatcher_ErrorHandler(t *testing.T) {
+	errFlush := errors.New("flush failed")
+	var failed []interface{}
+
+	b := NewBatcher(context.Background(), 2, time.Hour, func(context.Context, []interface{}) error {
+		return errFlush
+	}, WithFlushTaskOptions(WithMaxAttempts(2)), WithBatchErrorHandler(func(items []interface{}, err error) {
+		if err == errFlush {
+			failed = append(failed, items...)
+		}
+	}))
+	b.Start()
+
+	_ = b.Add("a")
+	_ = b.Add("b")
+	b.Stop()
+
+	if len(failed) != 2 {
+		t.Errorf("error handler got %v, want [a b]", failed)
+	}
+}
+
+func TestBatcher_TimedFlushDropped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	dropped := make(chan []interface{}, 1)
+
+	b := NewBatcher(ctx, 10, 10*time.Millisecond, func(context.Context, []interface{}) error {
+		return nil
+	}, WithBatchErrorHandler(func(items []interface{}, err error) {
+		if err == context.Canceled {
+			dropped <- items
+		}
+	}))
+	b.Start()
+
+	_ = b.Add("a")
+	cancel()
+
+	select {
+	case items := <-dropped:
+		if len(items) != 1 || items[0] != "a" {
+			t.Errorf("error handler got %v, want [a]", items)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("timed flush of a cancelled batcher not reported")
+	}
+}
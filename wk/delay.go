@@ -0,0 +1,104 @@
+package wk
+
+import (
+	"container/heap"
+	"time"
+)
+
+type delayedTask struct {
+	task *Task
+	at   time.Time
+}
+
+// delayHeap orders delayed tasks by due time
+type delayHeap []delayedTask
+
+func (h delayHeap) Len() int            { return len(h) }
+func (h delayHeap) Less(i, j int) bool  { return h[i].at.Before(h[j].at) }
+func (h delayHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *delayHeap) Push(x interface{}) { *h = append(*h, x.(delayedTask)) }
+func (h *delayHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = delayedTask{}
+	*h = old[:n-1]
+	return x
+}
+
+// DoAt queues the task when the time comes
+func (p *Pool) DoAt(t *Task, at time.Time) error {
+	if t == nil {
+		return nil
+	}
+
+	if err := p.parent.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+	heap.Push(&p.delayed, delayedTask{task: t, at: at})
+	p.mu.Unlock()
+
+	signal(p.wake)
+	return nil
+}
+
+// DoAfter queues the task after duration d
+func (p *Pool) DoAfter(t *Task, d time.Duration) error {
+	return p.DoAt(t, time.Now().Add(d))
+}
+
+// scheduler moves due tasks from the timer heap to the queue
+func (p *Pool) scheduler() {
+	defer p.wg.Done()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		p.mu.Lock()
+		now := time.Now()
+		var due []*Task
+		for len(p.delayed) > 0 && !p.delayed[0].at.After(now) {
+			due = append(due, heap.Pop(&p.delayed).(delayedTask).task)
+		}
+
+		wait := time.Hour
+		if len(p.delayed) > 0 {
+			wait = p.delayed[0].at.Sub(now)
+		}
+		p.mu.Unlock()
+
+		for i, t := range due {
+			if err := p.queue.push(t, p.quit); err != nil {
+				// keep the rest for StopNow
+				p.mu.Lock()
+				for _, t := range due[i:] {
+					heap.Push(&p.delayed, delayedTask{task: t, at: now})
+				}
+				p.mu.Unlock()
+				return
+			}
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-p.quit:
+			return
+		case <-p.wake:
+		case <-timer.C:
+		}
+	}
+}
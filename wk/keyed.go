@@ -0,0 +1,104 @@
+package wk
+
+import (
+	"context"
+	"hash/fnv"
+)
+
+// KeyedPool runs tasks of the same key one by one in submission order, tasks of different keys run in parallel.
+// Each key is hashed to a lane, a pool with a single worker.
+type KeyedPool struct {
+	lanes []*Pool
+}
+
+// NewKeyedPool create new keyed pool with numberLane lanes.
+// Options apply to every lane, except autoscaling and RejectCallerRuns which would break ordering.
+// Task priorities are ignored.
+func NewKeyedPool(ctx context.Context, numberLane int, opts ...PoolOption) *KeyedPool {
+	if numberLane <= 0 {
+		numberLane = 1
+	}
+
+	kp := &KeyedPool{
+		lanes: make([]*Pool, numberLane),
+	}
+
+	for i := range kp.lanes {
+		lane := NewPool(ctx, 1, opts...)
+		lane.autoscale = nil
+		if lane.policy == RejectCallerRuns {
+			lane.policy = RejectBlock
+		}
+
+		kp.lanes[i] = lane
+	}
+
+	return kp
+}
+
+// Start workers
+func (kp *KeyedPool) Start() {
+	for _, lane := range kp.lanes {
+		lane.Start()
+	}
+}
+
+// Do a task in the lane of key
+func (kp *KeyedPool) Do(key string, t *Task) error {
+	if t == nil {
+		return nil
+	}
+
+	t.priority = PriorityNormal
+	return kp.lane(key).Do(t)
+}
+
+// TryDo queues a task in the lane of key without waiting
+func (kp *KeyedPool) TryDo(key string, t *Task) error {
+	if t == nil {
+		return nil
+	}
+
+	t.priority = PriorityNormal
+	return kp.lane(key).TryDo(t)
+}
+
+// Stop workers. Wait all queued tasks done.
+func (kp *KeyedPool) Stop() {
+	_ = kp.Shutdown(context.Background())
+}
+
+// Shutdown stops all lanes, see Pool.Shutdown
+func (kp *KeyedPool) Shutdown(ctx context.Context) error {
+	errs := make(chan error, len(kp.lanes))
+	for _, lane := range kp.lanes {
+		go func(lane *Pool) {
+			errs <- lane.Shutdown(ctx)
+		}(lane)
+	}
+
+	var err error
+	for range kp.lanes {
+		if e := <-errs; e != nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// StopNow stops all lanes and returns tasks which were never executed
+func (kp *KeyedPool) StopNow() []*Task {
+	var tasks []*Task
+	for _, lane := range kp.lanes {
+		tasks = append(tasks, lane.StopNow()...)
+	}
+
+	return tasks
+}
+
+func (kp *KeyedPool) lane(key string) *Pool {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return kp.lanes[h.Sum32()%uint32(len(kp.lanes))]
+}
@@ -0,0 +1,83 @@
+package wk
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeyedPool_Ordering(t *testing.T) {
+	const (
+		numberKey  = 20
+		numberTask = 200
+	)
+
+	var (
+		mu      sync.Mutex
+		got     = make(map[string][]int)
+		running int32
+		peak    int32
+	)
+
+	kp := NewKeyedPool(context.Background(), 4, WithQueueSize(8))
+	kp.Start()
+
+	var wg sync.WaitGroup
+	for k := 0; k < numberKey; k++ {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+
+			for i := 0; i < numberTask; i++ {
+				_ = kp.Do(key, NewTask(context.Background(), i, func(_ context.Context, info interface{}) error {
+					n := atomic.AddInt32(&running, 1)
+					if n > atomic.LoadInt32(&peak) {
+						atomic.StoreInt32(&peak, n)
+					}
+					time.Sleep(time.Microsecond)
+
+					mu.Lock()
+					got[key] = append(got[key], info.(int))
+					mu.Unlock()
+
+					atomic.AddInt32(&running, -1)
+					return nil
+				}, WithPriority(Priority(i%3))))
+			}
+		}("user-" + strconv.Itoa(k))
+	}
+
+	wg.Wait()
+	kp.Stop()
+
+	for key, seq := range got {
+		if len(seq) != numberTask {
+			t.Errorf("key %v executed %v tasks, want %v", key, len(seq), numberTask)
+		}
+
+		for i := range seq {
+			if seq[i] != i {
+				t.Errorf("key %v executed task %v at position %v", key, seq[i], i)
+				break
+			}
+		}
+	}
+
+	if len(got) != numberKey {
+		t.Errorf("executed %v keys, want %v", len(got), numberKey)
+	}
+
+	if atomic.LoadInt32(&peak) < 2 {
+		t.Errorf("different keys did not run in parallel")
+	}
+}
+
+func TestKeyedPool_lane(t *testing.T) {
+	kp := NewKeyedPool(context.Background(), 8)
+	if kp.lane("order-1") != kp.lane("order-1") {
+		t.Errorf("lane() is not stable for the same key")
+	}
+}
@@ -0,0 +1,231 @@
+package wk
+
+import (
+	"context"
+	"sync"
+)
+
+// StageFunc transforms an item of a stage
+type StageFunc func(ctx context.Context, in interface{}) (interface{}, error)
+
+// Stage fans items out to its workers and fans results in to the next stage
+type Stage struct {
+	fn       StageFunc
+	workers  int
+	buffer   int
+	ordered  bool
+	taskOpts []TaskOption
+}
+
+// StageOption configures a stage
+type StageOption func(*Stage)
+
+// WithStageOrder emits results in the order items arrived at the stage.
+// Set it on every stage to keep the order of the pipeline input.
+func WithStageOrder() StageOption {
+	return func(s *Stage) {
+		s.ordered = true
+	}
+}
+
+// WithStageTaskOptions applies task options such as retries to each item
+func WithStageTaskOptions(opts ...TaskOption) StageOption {
+	return func(s *Stage) {
+		s.taskOpts = append(s.taskOpts, opts...)
+	}
+}
+
+// NewStage create new stage running fn on workers, with buffer items waiting at input and output
+func NewStage(fn StageFunc, workers, buffer int, opts ...StageOption) *Stage {
+	if workers <= 0 {
+		workers = 1
+	}
+
+	if buffer < 0 {
+		buffer = 0
+	}
+
+	s := &Stage{
+		fn:      fn,
+		workers: workers,
+		buffer:  buffer,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Pipeline chains stages, results of a stage flow to the next one
+type Pipeline struct {
+	stages []*Stage
+}
+
+// NewPipeline create new pipeline
+func NewPipeline(stages ...*Stage) *Pipeline {
+	return &Pipeline{
+		stages: stages,
+	}
+}
+
+// Run feeds items from in through all stages. The first error cancels every stage.
+// Read out until it is closed, then wait returns the first error.
+func (pl *Pipeline) Run(ctx context.Context, in <-chan interface{}) (out <-chan interface{}, wait func() error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	r := &pipelineRun{}
+	r.ctx, r.cancel = context.WithCancel(ctx)
+
+	out = in
+	for _, s := range pl.stages {
+		out = r.stage(s, out)
+	}
+
+	go func() {
+		r.wg.Wait()
+		r.cancel()
+	}()
+
+	return out, func() error {
+		r.wg.Wait()
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.err == nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return r.err
+	}
+}
+
+type pipelineRun struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+func (r *pipelineRun) fail(err error) {
+	r.mu.Lock()
+	if r.err == nil {
+		r.err = err
+	}
+	r.mu.Unlock()
+
+	r.cancel()
+}
+
+type stageResult struct {
+	seq uint64
+	v   interface{}
+}
+
+func (r *pipelineRun) stage(s *Stage, in <-chan interface{}) <-chan interface{} {
+	out := make(chan interface{}, s.buffer)
+	results := make(chan stageResult, s.buffer)
+
+	pool := NewPool(r.ctx, s.workers, WithQueueSize(s.buffer+1))
+	pool.Start()
+
+	r.wg.Add(2)
+	go func() {
+		defer r.wg.Done()
+		defer close(results)
+
+		r.dispatch(s, pool, in, results)
+	}()
+
+	go func() {
+		defer r.wg.Done()
+		defer close(out)
+
+		if s.ordered {
+			r.reorder(results, out)
+			return
+		}
+
+		for res := range results {
+			r.emit(out, res.v)
+		}
+	}()
+
+	return out
+}
+
+// dispatch submits an item task to pool until in is closed or the run is cancelled
+func (r *pipelineRun) dispatch(s *Stage, pool *Pool, in <-chan interface{}, results chan<- stageResult) {
+	var seq uint64
+	for {
+		select {
+		case <-r.ctx.Done():
+			pool.StopNow()
+			return
+
+		case item, ok := <-in:
+			if !ok {
+				pool.Stop()
+				return
+			}
+
+			var v interface{}
+			t := NewTask(r.ctx, item, func(ctx context.Context, info interface{}) (err error) {
+				v, err = s.fn(ctx, info)
+				return
+			}, s.taskOpts...)
+
+			res := stageResult{seq: seq}
+			t.onDone = func(result Result) {
+				if result.Err != nil {
+					r.fail(result.Err)
+					return
+				}
+
+				res.v = v
+				select {
+				case <-r.ctx.Done():
+				case results <- res:
+				}
+			}
+
+			if err := pool.Do(t); err != nil {
+				pool.StopNow()
+				return
+			}
+			seq++
+		}
+	}
+}
+
+// reorder holds early results until all previous ones are emitted
+func (r *pipelineRun) reorder(results <-chan stageResult, out chan<- interface{}) {
+	var next uint64
+	pending := make(map[uint64]interface{})
+	for res := range results {
+		pending[res.seq] = res.v
+		for {
+			v, ok := pending[next]
+			if !ok {
+				break
+			}
+
+			delete(pending, next)
+			next++
+			r.emit(out, v)
+		}
+	}
+}
+
+func (r *pipelineRun) emit(out chan<- interface{}, v interface{}) {
+	select {
+	case <-r.ctx.Done():
+	case out <- v:
+	}
+}
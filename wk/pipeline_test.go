@@ -0,0 +1,151 @@
+package wk
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+)
+
+func feed(n int) <-chan interface{} {
+	in := make(chan interface{})
+	go func() {
+		defer close(in)
+		for i := 0; i < n; i++ {
+			in <- i
+		}
+	}()
+
+	return in
+}
+
+func jitter(ctx context.Context, v interface{}) (interface{}, error) {
+	time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+	return v, nil
+}
+
+func TestPipeline_Run(t *testing.T) {
+	square := func(_ context.Context, v interface{}) (interface{}, error) {
+		return v.(int) * v.(int), nil
+	}
+
+	tests := []struct {
+		name    string
+		ordered bool
+	}{
+		{name: "unordered"},
+		{name: "ordered", ordered: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []StageOption
+			if tt.ordered {
+				opts = append(opts, WithStageOrder())
+			}
+
+			pl := NewPipeline(
+				NewStage(jitter, 4, 2, opts...),
+				NewStage(square, 3, 1, opts...),
+				NewStage(jitter, 4, 2, opts...),
+			)
+
+			out, wait := pl.Run(context.Background(), feed(100))
+
+			var got []int
+			for v := range out {
+				got = append(got, v.(int))
+			}
+
+			if err := wait(); err != nil {
+				t.Fatalf("wait() error = %v", err)
+			}
+
+			if len(got) != 100 {
+				t.Fatalf("Run() emitted %v results, want 100", len(got))
+			}
+
+			if !tt.ordered {
+				sort.Ints(got)
+			}
+
+			for i := range got {
+				if got[i] != i*i {
+					t.Fatalf("result %v = %v, want %v", i, got[i], i*i)
+				}
+			}
+		})
+	}
+}
+
+func TestPipeline_Error(t *testing.T) {
+	errBad := errors.New("bad item")
+	fail := func(ctx context.Context, v interface{}) (interface{}, error) {
+		if v.(int) == 10 {
+			return nil, errBad
+		}
+		return v, nil
+	}
+
+	pl := NewPipeline(
+		NewStage(fail, 2, 1),
+		NewStage(jitter, 2, 1),
+	)
+
+	in := make(chan interface{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		defer close(in)
+		for i := 0; ; i++ {
+			select {
+			case <-ctx.Done():
+				return
+			case in <- i:
+			}
+		}
+	}()
+
+	out, wait := pl.Run(ctx, in)
+
+	count := 0
+	for range out {
+		count++
+	}
+
+	if err := wait(); err != errBad {
+		t.Errorf("wait() error = %v, want %v", err, errBad)
+	}
+
+	if count > 100 {
+		t.Errorf("pipeline did not short-circuit, emitted %v results", count)
+	}
+}
+
+func TestPipeline_Retry(t *testing.T) {
+	failures := map[int]bool{3: true, 7: true}
+	flaky := func(ctx context.Context, v interface{}) (interface{}, error) {
+		if failures[v.(int)] {
+			delete(failures, v.(int))
+			return nil, errors.New("flaky")
+		}
+		return v, nil
+	}
+
+	pl := NewPipeline(NewStage(flaky, 1, 0, WithStageOrder(), WithStageTaskOptions(WithMaxAttempts(2))))
+	out, wait := pl.Run(context.Background(), feed(10))
+
+	next := 0
+	for v := range out {
+		if v.(int) != next {
+			t.Errorf("result = %v, want %v", v, next)
+		}
+		next++
+	}
+
+	if err := wait(); err != nil || next != 10 {
+		t.Errorf("wait() error = %v after %v results, want nil after 10", err, next)
+	}
+}
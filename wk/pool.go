@@ -1,21 +1,99 @@
 package wk
 
 import (
+	"container/heap"
 	"context"
 	"sync"
+	"time"
 )
 
+const defaultAging = time.Second
+
 // Pool of worker
 type Pool struct {
+	parent       context.Context
 	ctx          context.Context
 	cancel       context.CancelFunc
 	numberWorker int
 	wg           sync.WaitGroup
-	ch           chan *Task
+	queue        *taskQueue
+
+	mu      sync.Mutex
+	closed  bool
+	quit    chan struct{}
+	once    sync.Once
+	skipped []*Task
+	delayed delayHeap
+	wake    chan struct{}
+
+	retires []chan struct{}
+	started bool
+	metrics metrics
+
+	aging          time.Duration
+	queueSize      int
+	policy         RejectPolicy
+	autoscale      *AutoscaleConfig
+	panicHandlers  []func(interface{})
+	droppedHandler func(*Task, error)
+}
+
+// RejectPolicy decides what Do does when the queue is full
+type RejectPolicy int
+
+// Reject policies
+const (
+	// RejectBlock waits for a free slot
+	RejectBlock RejectPolicy = iota
+	// RejectDropNewest drops the submitted task
+	RejectDropNewest
+	// RejectDropOldest drops the longest waiting task to make room
+	RejectDropOldest
+	// RejectCallerRuns executes the task in the calling goroutine
+	RejectCallerRuns
+)
+
+// PoolOption configures a pool
+type PoolOption func(*Pool)
+
+// WithPanicHandler adds handlers called with the recovered value when a task panics
+func WithPanicHandler(handlers ...func(interface{})) PoolOption {
+	return func(p *Pool) {
+		p.panicHandlers = append(p.panicHandlers, handlers...)
+	}
+}
+
+// WithPriorityAging raises priority of a waiting task by one level every d, default 1s.
+// Zero disables aging, lower priorities may starve then.
+func WithPriorityAging(d time.Duration) PoolOption {
+	return func(p *Pool) {
+		p.aging = d
+	}
+}
+
+// WithQueueSize sets how many tasks can wait for a worker, default the number of workers
+func WithQueueSize(n int) PoolOption {
+	return func(p *Pool) {
+		p.queueSize = n
+	}
+}
+
+// WithRejectPolicy sets what Do does when the queue is full, default RejectBlock
+func WithRejectPolicy(policy RejectPolicy) PoolOption {
+	return func(p *Pool) {
+		p.policy = policy
+	}
+}
+
+// WithDroppedHandler sets the callback of tasks dropped by the reject policy or by stopping the pool
+func WithDroppedHandler(fn func(*Task, error)) PoolOption {
+	return func(p *Pool) {
+		p.droppedHandler = fn
+	}
 }
 
 // NewPool create new worker pool
-func NewPool(ctx context.Context, numberWorker int) (p *Pool) {
+func NewPool(ctx context.Context, numberWorker int, opts ...PoolOption) (p *Pool) {
 	if numberWorker <= 0 {
 		numberWorker = 1
 	}
@@ -25,52 +103,217 @@ func NewPool(ctx context.Context, numberWorker int) (p *Pool) {
 	}
 
 	p = &Pool{
+		parent:       ctx,
 		numberWorker: numberWorker,
-		ch:           make(chan *Task, numberWorker),
+		quit:         make(chan struct{}),
+		wake:         make(chan struct{}, 1),
+		aging:        defaultAging,
 	}
 	p.ctx, p.cancel = context.WithCancel(ctx)
 
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if p.queueSize <= 0 {
+		p.queueSize = numberWorker
+	}
+
+	p.queue = newTaskQueue(p.queueSize, p.aging)
 	return
 }
 
 // Start workers
 func (p *Pool) Start() {
-	p.wg.Add(p.numberWorker + 1)
-	for i := 0; i < p.numberWorker; i++ {
-		go p.worker()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.started || p.closed {
+		return
 	}
+	p.started = true
+
+	p.wg.Add(1)
+	go p.scheduler()
+
+	if p.autoscale != nil {
+		p.wg.Add(1)
+		go p.autoscaler()
+	}
+
+	p.resize(p.numberWorker)
 }
 
-// Do a task
-func (p *Pool) Do(t *Task) {
-	if p.ch != nil && t != nil {
-		select {
-		case <-p.ctx.Done():
-		case p.ch <- t:
+// Do a task. When the queue is full the reject policy applies.
+// A dropped task is passed to the dropped handler and its reason is returned,
+// the error of the pool ctx once it is done.
+func (p *Pool) Do(t *Task) error {
+	if t == nil {
+		return nil
+	}
+
+	if err := p.parent.Err(); err != nil {
+		p.dropped(t, err)
+		return err
+	}
+
+	var err error
+	switch p.policy {
+	case RejectDropNewest:
+		err = p.queue.tryPush(t)
+
+	case RejectDropOldest:
+		var evicted *Task
+		evicted, err = p.queue.pushEvict(t)
+		if evicted != nil {
+			p.dropped(evicted, ErrPoolFull)
+		}
+
+	case RejectCallerRuns:
+		err = p.queue.tryPush(t)
+		if err == ErrPoolFull {
+			t.execute(p.panicHandlers...)
+			return nil
 		}
+
+	default:
+		err = p.queue.push(t, p.ctx.Done())
+	}
+
+	if err != nil {
+		p.dropped(t, err)
 	}
+
+	return err
 }
 
-// Stop worker. Wait all task done.
+// TryDo queues a task without waiting, it returns ErrPoolFull when the queue is full
+func (p *Pool) TryDo(t *Task) error {
+	if t == nil {
+		return nil
+	}
+
+	if err := p.parent.Err(); err != nil {
+		return err
+	}
+
+	return p.queue.tryPush(t)
+}
+
+// Stop worker. Wait all queued tasks done.
 func (p *Pool) Stop() {
-	p.cancel()
+	_ = p.Shutdown(context.Background())
+}
+
+// Shutdown stops accepting new tasks and waits for workers to finish the queued ones.
+// Delayed tasks which are not due yet are passed to the dropped handler.
+// If ctx is done first, workers stop picking up tasks and ctx.Err() is returned
+// without waiting for the running ones.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.close()
 
-	// wait child workers
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancel()
+		p.dropPending()
+		return nil
+
+	case <-ctx.Done():
+		p.cancel()
+		p.dropPending()
+		return ctx.Err()
+	}
+}
+
+// StopNow cancels workers without draining the queue and returns tasks which were never executed,
+// including delayed ones.
+func (p *Pool) StopNow() []*Task {
+	p.cancel()
+	p.close()
 	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tasks := append(p.skipped, p.queue.drain()...)
+	for p.delayed.Len() > 0 {
+		tasks = append(tasks, heap.Pop(&p.delayed).(delayedTask).task)
+	}
+
+	return tasks
 }
 
-func (p *Pool) worker() {
+// Done is closed once workers stop picking up tasks,
+// after Shutdown, StopNow or when the parent ctx is done.
+func (p *Pool) Done() <-chan struct{} {
+	return p.ctx.Done()
+}
+
+// dropPending passes tasks left in queue and timer heap to the dropped handler
+func (p *Pool) dropPending() {
+	tasks := p.queue.drain()
+
+	p.mu.Lock()
+	for p.delayed.Len() > 0 {
+		tasks = append(tasks, heap.Pop(&p.delayed).(delayedTask).task)
+	}
+	p.mu.Unlock()
+
+	for _, t := range tasks {
+		p.dropped(t, ErrPoolClosed)
+	}
+}
+
+func (p *Pool) dropped(t *Task, err error) {
+	if p.droppedHandler != nil {
+		p.droppedHandler(t, err)
+	}
+}
+
+// close rejects new tasks and unblocks pending Do calls
+func (p *Pool) close() {
+	p.once.Do(func() {
+		p.mu.Lock()
+		p.closed = true
+		p.mu.Unlock()
+
+		close(p.quit)
+		p.queue.close()
+	})
+}
+
+func (p *Pool) worker(retire <-chan struct{}) {
 	defer p.wg.Done()
 
-	var task *Task
 	for {
 		select {
-		case <-p.ctx.Done():
+		case <-retire:
+			return
+		default:
+		}
+
+		qt, ok := p.queue.pop(p.ctx.Done(), retire)
+		if !ok {
 			return
-		case task = <-p.ch:
-			if task != nil {
-				task.Execute()
-			}
 		}
+
+		// cancelled while receiving, hand the task back to StopNow
+		if p.ctx.Err() != nil {
+			p.mu.Lock()
+			p.skipped = append(p.skipped, qt.task)
+			p.mu.Unlock()
+			return
+		}
+
+		start := time.Now()
+		p.metrics.begin(start.Sub(qt.at))
+		qt.task.execute(p.panicHandlers...)
+		p.metrics.end(time.Since(start))
 	}
 }
@@ -0,0 +1,363 @@
+package wk
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func countTask(counter *int32, delay time.Duration) *Task {
+	return NewTask(context.Background(), nil, func(context.Context, interface{}) error {
+		time.Sleep(delay)
+		atomic.AddInt32(counter, 1)
+		return nil
+	})
+}
+
+func TestPool_Shutdown(t *testing.T) {
+	var counter int32
+	p := NewPool(context.Background(), 2)
+	p.Start()
+
+	for i := 0; i < 10; i++ {
+		p.Do(countTask(&counter, time.Millisecond))
+	}
+
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	if got := atomic.LoadInt32(&counter); got != 10 {
+		t.Errorf("Shutdown() executed %v tasks, want 10", got)
+	}
+
+	if err := p.Do(countTask(&counter, 0)); err != ErrPoolClosed {
+		t.Errorf("Do() after Shutdown error = %v, want %v", err, ErrPoolClosed)
+	}
+	if got := atomic.LoadInt32(&counter); got != 10 {
+		t.Errorf("Do() after Shutdown executed task, got %v", got)
+	}
+}
+
+func TestPool_ShutdownDeadline(t *testing.T) {
+	var counter int32
+	p := NewPool(context.Background(), 1)
+	p.Start()
+
+	p.Do(countTask(&counter, 200*time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := p.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("Shutdown() took %v, deadline was not honored", d)
+	}
+}
+
+func TestPool_Stop(t *testing.T) {
+	var counter int32
+	p := NewPool(context.Background(), 3)
+	p.Start()
+
+	for i := 0; i < 5; i++ {
+		p.Do(countTask(&counter, 0))
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Stop() deadlocked")
+	}
+
+	if got := atomic.LoadInt32(&counter); got != 5 {
+		t.Errorf("Stop() executed %v tasks, want 5", got)
+	}
+}
+
+func TestPool_StopNow(t *testing.T) {
+	var counter int32
+	block := make(chan struct{})
+
+	p := NewPool(context.Background(), 1, WithQueueSize(10))
+	p.Start()
+
+	started := make(chan struct{})
+	p.Do(NewTask(context.Background(), nil, func(context.Context, interface{}) error {
+		close(started)
+		<-block
+		return nil
+	}))
+	<-started
+
+	for i := 0; i < 5; i++ {
+		p.Do(countTask(&counter, 0))
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(block)
+	}()
+
+	tasks := p.StopNow()
+	if len(tasks) != 5 {
+		t.Errorf("StopNow() returned %v tasks, want 5", len(tasks))
+	}
+
+	if got := atomic.LoadInt32(&counter); got != 0 {
+		t.Errorf("StopNow() executed %v queued tasks, want 0", got)
+	}
+}
+
+func TestPool_Panic(t *testing.T) {
+	var counter int32
+	recovered := make(chan interface{}, 1)
+
+	p := NewPool(context.Background(), 1, WithPanicHandler(func(r interface{}) {
+		recovered <- r
+	}))
+	p.Start()
+
+	panicked := NewTask(context.Background(), nil, func(context.Context, interface{}) error {
+		panic("boom")
+	})
+	p.Do(panicked)
+	p.Do(countTask(&counter, 0))
+	p.Stop()
+
+	if got := atomic.LoadInt32(&counter); got != 1 {
+		t.Errorf("worker died after panic, executed %v tasks, want 1", got)
+	}
+
+	if r := <-recovered; r != "boom" {
+		t.Errorf("panic handler got %v, want boom", r)
+	}
+
+	err, ok := panicked.Result().Err.(*PanicError)
+	if !ok {
+		t.Fatalf("Result().Err = %T, want *PanicError", panicked.Result().Err)
+	}
+
+	if err.Value != "boom" || !strings.Contains(string(err.Stack), "TestPool_Panic") {
+		t.Errorf("PanicError = %v, want value boom with stack", err)
+	}
+}
+
+func TestPool_Priority(t *testing.T) {
+	var order []string
+	block := make(chan struct{})
+
+	p := NewPool(context.Background(), 1, WithQueueSize(10), WithPriorityAging(0))
+	p.Start()
+
+	p.Do(NewTask(context.Background(), nil, func(context.Context, interface{}) error {
+		<-block
+		return nil
+	}))
+
+	record := func(name string, priority Priority) *Task {
+		return NewTask(context.Background(), name, func(_ context.Context, info interface{}) error {
+			order = append(order, info.(string))
+			return nil
+		}, WithPriority(priority))
+	}
+
+	p.Do(record("low", PriorityLow))
+	p.Do(record("normal-1", PriorityNormal))
+	p.Do(record("high", PriorityHigh))
+	p.Do(record("normal-2", PriorityNormal))
+	close(block)
+	p.Stop()
+
+	want := []string{"high", "normal-1", "normal-2", "low"}
+	if strings.Join(order, ",") != strings.Join(want, ",") {
+		t.Errorf("execution order = %v, want %v", order, want)
+	}
+}
+
+func TestTaskQueue_Aging(t *testing.T) {
+	q := newTaskQueue(10, time.Second)
+	now := time.Now()
+
+	low := NewTask(context.Background(), nil, nil, WithPriority(PriorityLow))
+	high := NewTask(context.Background(), nil, nil, WithPriority(PriorityHigh))
+	q.levels[PriorityLow] = []queuedTask{{task: low, at: now.Add(-3 * time.Second)}}
+	q.levels[PriorityHigh] = []queuedTask{{task: high, at: now}}
+	q.size = 2
+
+	if got := q.take(now); got.task != low {
+		t.Errorf("take() did not promote the starving low priority task")
+	}
+}
+
+func TestPool_DoAfter(t *testing.T) {
+	var counter int32
+	p := NewPool(context.Background(), 1)
+	p.Start()
+
+	start := time.Now()
+	done := make(chan time.Time, 2)
+	for _, d := range []time.Duration{40 * time.Millisecond, 20 * time.Millisecond} {
+		_ = p.DoAfter(NewTask(context.Background(), d, func(_ context.Context, info interface{}) error {
+			done <- time.Now()
+			atomic.AddInt32(&counter, int32(info.(time.Duration)/time.Millisecond))
+			return nil
+		}), d)
+	}
+
+	first := <-done
+	if atomic.LoadInt32(&counter) != 20 || first.Sub(start) < 20*time.Millisecond {
+		t.Errorf("DoAfter() ran the wrong task first or too early after %v", first.Sub(start))
+	}
+
+	<-done
+	p.Stop()
+
+	if err := p.DoAt(countTask(&counter, 0), time.Now()); err != ErrPoolClosed {
+		t.Errorf("DoAt() after Stop error = %v, want %v", err, ErrPoolClosed)
+	}
+}
+
+func TestPool_StopNowDelayed(t *testing.T) {
+	var counter int32
+	p := NewPool(context.Background(), 1)
+	p.Start()
+
+	_ = p.DoAfter(countTask(&counter, 0), time.Hour)
+	if tasks := p.StopNow(); len(tasks) != 1 {
+		t.Errorf("StopNow() returned %v tasks, want 1 delayed task", len(tasks))
+	}
+}
+
+func TestPool_RejectPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      RejectPolicy
+		wantErr     error
+		wantDropped string
+		wantRun     []string
+	}{
+		{
+			name:        "drop newest",
+			policy:      RejectDropNewest,
+			wantErr:     ErrPoolFull,
+			wantDropped: "newest",
+			wantRun:     []string{"oldest"},
+		},
+		{
+			name:        "drop oldest",
+			policy:      RejectDropOldest,
+			wantDropped: "oldest",
+			wantRun:     []string{"newest"},
+		},
+		{
+			name:    "caller runs",
+			policy:  RejectCallerRuns,
+			wantRun: []string{"newest", "oldest"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				run     []string
+				dropped string
+			)
+			record := func(name string) *Task {
+				return NewTask(context.Background(), name, func(_ context.Context, info interface{}) error {
+					mu.Lock()
+					run = append(run, info.(string))
+					mu.Unlock()
+					return nil
+				})
+			}
+
+			p := NewPool(context.Background(), 1, WithQueueSize(1), WithRejectPolicy(tt.policy), WithDroppedHandler(func(t *Task, _ error) {
+				dropped = t.info.(string)
+			}))
+
+			if err := p.Do(record("oldest")); err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			if err := p.Do(record("newest")); err != tt.wantErr {
+				t.Errorf("Do() error = %v, want %v", err, tt.wantErr)
+			}
+
+			p.Start()
+			p.Stop()
+
+			if dropped != tt.wantDropped {
+				t.Errorf("dropped task = %q, want %q", dropped, tt.wantDropped)
+			}
+			if strings.Join(run, ",") != strings.Join(tt.wantRun, ",") {
+				t.Errorf("executed tasks = %v, want %v", run, tt.wantRun)
+			}
+		})
+	}
+}
+
+func TestPool_TryDo(t *testing.T) {
+	var counter int32
+	p := NewPool(context.Background(), 1, WithQueueSize(2))
+
+	for i := 0; i < 2; i++ {
+		if err := p.TryDo(countTask(&counter, 0)); err != nil {
+			t.Fatalf("TryDo() error = %v", err)
+		}
+	}
+	if err := p.TryDo(countTask(&counter, 0)); err != ErrPoolFull {
+		t.Errorf("TryDo() on full queue error = %v, want %v", err, ErrPoolFull)
+	}
+
+	p.Start()
+	p.Stop()
+
+	if err := p.TryDo(countTask(&counter, 0)); err != ErrPoolClosed {
+		t.Errorf("TryDo() after Stop error = %v, want %v", err, ErrPoolClosed)
+	}
+	if got := atomic.LoadInt32(&counter); got != 2 {
+		t.Errorf("executed %v tasks, want 2", got)
+	}
+}
+
+func TestPool_DoCancelled(t *testing.T) {
+	var dropped int32
+	ctx, cancel := context.WithCancel(context.Background())
+	p := NewPool(ctx, 1, WithDroppedHandler(func(*Task, error) {
+		atomic.AddInt32(&dropped, 1)
+	}))
+
+	_ = p.Do(countTask(new(int32), 0))
+	cancel()
+
+	tests := []struct {
+		name string
+		do   func() error
+	}{
+		{"Do", func() error { return p.Do(countTask(new(int32), 0)) }},
+		{"TryDo", func() error { return p.TryDo(countTask(new(int32), 0)) }},
+		{"DoAfter", func() error { return p.DoAfter(countTask(new(int32), 0), time.Millisecond) }},
+	}
+	for _, tt := range tests {
+		if err := tt.do(); err != context.Canceled {
+			t.Errorf("%v() on cancelled pool error = %v, want %v", tt.name, err, context.Canceled)
+		}
+	}
+
+	if got := atomic.LoadInt32(&dropped); got != 1 {
+		t.Errorf("dropped handler called %v times, want 1", got)
+	}
+}
@@ -0,0 +1,253 @@
+package wk
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Priority of a task in pool
+type Priority int
+
+// Priority levels, higher runs first
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+
+	numberPriority = int(PriorityHigh) + 1
+)
+
+// Errors of submitting tasks
+var (
+	ErrPoolClosed = errors.New("wk: pool is closed")
+	ErrPoolFull   = errors.New("wk: pool is full")
+)
+
+type queuedTask struct {
+	task *Task
+	at   time.Time
+}
+
+// taskQueue is a bounded FIFO per priority level.
+// Every aging interval a waiting task spends in queue raises its priority by one level, so low levels never starve.
+type taskQueue struct {
+	mu       sync.Mutex
+	levels   [numberPriority][]queuedTask
+	size     int
+	capacity int
+	aging    time.Duration
+	closed   bool
+
+	notEmpty chan struct{}
+	notFull  chan struct{}
+	done     chan struct{}
+}
+
+func newTaskQueue(capacity int, aging time.Duration) *taskQueue {
+	return &taskQueue{
+		capacity: capacity,
+		aging:    aging,
+		notEmpty: make(chan struct{}, 1),
+		notFull:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+}
+
+// push waits for a free slot until abort is closed
+func (q *taskQueue) push(t *Task, abort <-chan struct{}) error {
+	for {
+		err := q.tryPush(t)
+		if err != ErrPoolFull {
+			return err
+		}
+
+		select {
+		case <-q.notFull:
+		case <-q.done:
+		case <-abort:
+			return ErrPoolClosed
+		}
+	}
+}
+
+// tryPush returns ErrPoolFull instead of waiting for a free slot
+func (q *taskQueue) tryPush(t *Task) error {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ErrPoolClosed
+	}
+
+	if q.size >= q.capacity {
+		q.mu.Unlock()
+		return ErrPoolFull
+	}
+
+	q.add(t)
+	q.mu.Unlock()
+
+	signal(q.notEmpty)
+	return nil
+}
+
+// pushEvict makes room by removing the longest waiting task when the queue is full
+func (q *taskQueue) pushEvict(t *Task) (*Task, error) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil, ErrPoolClosed
+	}
+
+	var evicted *Task
+	if q.size >= q.capacity {
+		oldest := -1
+		for lv := range q.levels {
+			if len(q.levels[lv]) > 0 && (oldest < 0 || q.levels[lv][0].at.Before(q.levels[oldest][0].at)) {
+				oldest = lv
+			}
+		}
+
+		evicted = q.levels[oldest][0].task
+		q.levels[oldest][0] = queuedTask{}
+		q.levels[oldest] = q.levels[oldest][1:]
+		q.size--
+	}
+
+	q.add(t)
+	q.mu.Unlock()
+
+	signal(q.notEmpty)
+	return evicted, nil
+}
+
+// add requires q.mu held
+func (q *taskQueue) add(t *Task) {
+	lv := t.priority.level()
+	q.levels[lv] = append(q.levels[lv], queuedTask{task: t, at: time.Now()})
+	q.size++
+	if q.size < q.capacity {
+		signal(q.notFull)
+	}
+}
+
+// pop waits for a task until the queue is closed and empty, or cancel or retire is closed
+func (q *taskQueue) pop(cancel, retire <-chan struct{}) (queuedTask, bool) {
+	for {
+		q.mu.Lock()
+		if q.size > 0 {
+			t := q.take(time.Now())
+			if q.size > 0 {
+				signal(q.notEmpty)
+			}
+			q.mu.Unlock()
+
+			signal(q.notFull)
+			return t, true
+		}
+
+		if q.closed {
+			q.mu.Unlock()
+			return queuedTask{}, false
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.notEmpty:
+		case <-q.done:
+		case <-cancel:
+			return queuedTask{}, false
+		case <-retire:
+			return queuedTask{}, false
+		}
+	}
+}
+
+// take removes the head with the highest aged priority, ties go to the higher level
+func (q *taskQueue) take(now time.Time) queuedTask {
+	best, bestScore := -1, 0
+	for lv := numberPriority - 1; lv >= 0; lv-- {
+		if len(q.levels[lv]) == 0 {
+			continue
+		}
+
+		score := lv
+		if q.aging > 0 {
+			score += int(now.Sub(q.levels[lv][0].at) / q.aging)
+		}
+
+		if best < 0 || score > bestScore {
+			best, bestScore = lv, score
+		}
+	}
+
+	t := q.levels[best][0]
+	q.levels[best][0] = queuedTask{}
+	q.levels[best] = q.levels[best][1:]
+	q.size--
+	return t
+}
+
+func (q *taskQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.size
+}
+
+// oldest returns how long the longest waiting task is queued
+func (q *taskQueue) oldest(now time.Time) time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var d time.Duration
+	for lv := range q.levels {
+		if len(q.levels[lv]) > 0 && now.Sub(q.levels[lv][0].at) > d {
+			d = now.Sub(q.levels[lv][0].at)
+		}
+	}
+
+	return d
+}
+
+func (q *taskQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.closed {
+		q.closed = true
+		close(q.done)
+	}
+}
+
+// drain removes all queued tasks
+func (q *taskQueue) drain() []*Task {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var tasks []*Task
+	for q.size > 0 {
+		tasks = append(tasks, q.take(time.Now()).task)
+	}
+
+	return tasks
+}
+
+func (p Priority) level() int {
+	switch {
+	case p < PriorityLow:
+		return int(PriorityLow)
+	case p > PriorityHigh:
+		return int(PriorityHigh)
+	default:
+		return int(p)
+	}
+}
+
+// signal wakes up one waiter without blocking
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,206 @@
+package wk
+
+import (
+	"sync"
+	"time"
+)
+
+// ewmaWeight is the weight of the newest sample in moving averages
+const ewmaWeight = 0.2
+
+// Stats of a pool
+type Stats struct {
+	// Workers is the number of running workers
+	Workers int
+	// Active is the number of workers executing a task
+	Active int
+	// Queued is the number of tasks waiting for a worker
+	Queued int
+	// Delayed is the number of tasks waiting for their time
+	Delayed int
+	// Completed is the number of executed tasks
+	Completed uint64
+	// Oldest is how long the longest waiting task is queued
+	Oldest time.Duration
+	// Wait is the moving average of time spent in queue
+	Wait time.Duration
+	// Latency is the moving average of execution time
+	Latency time.Duration
+}
+
+// AutoscaleConfig bounds the number of workers of an autoscaled pool
+type AutoscaleConfig struct {
+	Min int
+	Max int
+	// MaxWait adds a worker when tasks wait longer than it in queue, default 100ms
+	MaxWait time.Duration
+	// IdleTime removes a worker after some workers stay idle for this long, default 1m
+	IdleTime time.Duration
+	// Interval between two checks, default 1s
+	Interval time.Duration
+}
+
+// WithAutoscale grows and shrinks workers within [cfg.Min, cfg.Max] depending on load
+func WithAutoscale(cfg AutoscaleConfig) PoolOption {
+	return func(p *Pool) {
+		if cfg.Min <= 0 {
+			cfg.Min = 1
+		}
+		if cfg.Max < cfg.Min {
+			cfg.Max = cfg.Min
+		}
+		if cfg.MaxWait <= 0 {
+			cfg.MaxWait = 100 * time.Millisecond
+		}
+		if cfg.IdleTime <= 0 {
+			cfg.IdleTime = time.Minute
+		}
+		if cfg.Interval <= 0 {
+			cfg.Interval = time.Second
+		}
+
+		p.autoscale = &cfg
+	}
+}
+
+type metrics struct {
+	mu        sync.Mutex
+	active    int
+	completed uint64
+	wait      time.Duration
+	latency   time.Duration
+}
+
+func (m *metrics) begin(wait time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.active++
+	m.wait = ewma(m.wait, wait, m.completed == 0)
+}
+
+func (m *metrics) end(latency time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.active--
+	m.latency = ewma(m.latency, latency, m.completed == 0)
+	m.completed++
+}
+
+func ewma(avg, sample time.Duration, first bool) time.Duration {
+	if first {
+		return sample
+	}
+
+	return time.Duration(ewmaWeight*float64(sample) + (1-ewmaWeight)*float64(avg))
+}
+
+// Resize changes the number of workers, running tasks are not interrupted
+func (p *Pool) Resize(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.resize(n)
+}
+
+// resize requires p.mu held
+func (p *Pool) resize(n int) {
+	if n <= 0 {
+		n = 1
+	}
+
+	if p.closed {
+		return
+	}
+
+	p.numberWorker = n
+	if !p.started {
+		return
+	}
+
+	for len(p.retires) < n {
+		retire := make(chan struct{})
+		p.retires = append(p.retires, retire)
+
+		p.wg.Add(1)
+		go p.worker(retire)
+	}
+
+	for len(p.retires) > n {
+		last := len(p.retires) - 1
+		close(p.retires[last])
+		p.retires = p.retires[:last]
+	}
+}
+
+// Stats returns current workers, queue depth and task latency
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	s := Stats{
+		Workers: p.numberWorker,
+		Delayed: p.delayed.Len(),
+	}
+	p.mu.Unlock()
+
+	s.Queued = p.queue.len()
+	s.Oldest = p.queue.oldest(time.Now())
+
+	p.metrics.mu.Lock()
+	s.Active = p.metrics.active
+	s.Completed = p.metrics.completed
+	s.Wait = p.metrics.wait
+	s.Latency = p.metrics.latency
+	p.metrics.mu.Unlock()
+
+	return s
+}
+
+func (p *Pool) autoscaler() {
+	defer p.wg.Done()
+
+	cfg := p.autoscale
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	var idleSince time.Time
+	for {
+		select {
+		case <-p.quit:
+			return
+		case now := <-ticker.C:
+			idleSince = p.scale(cfg, p.Stats(), idleSince, now)
+		}
+	}
+}
+
+// scale adds a worker when tasks wait too long, removes one after workers idle for cfg.IdleTime.
+// It returns the time since workers are idle, zero if all of them are busy.
+func (p *Pool) scale(cfg *AutoscaleConfig, s Stats, idleSince, now time.Time) time.Time {
+	switch {
+	case s.Workers < cfg.Min:
+		p.Resize(cfg.Min)
+
+	case s.Workers > cfg.Max:
+		p.Resize(cfg.Max)
+
+	case s.Queued > 0 && (s.Wait > cfg.MaxWait || s.Oldest > cfg.MaxWait):
+		if s.Workers < cfg.Max {
+			p.Resize(s.Workers + 1)
+		}
+
+	case s.Active < s.Workers:
+		if idleSince.IsZero() {
+			return now
+		}
+
+		if now.Sub(idleSince) >= cfg.IdleTime && s.Workers > cfg.Min {
+			p.Resize(s.Workers - 1)
+			return now
+		}
+
+		return idleSince
+	}
+
+	return time.Time{}
+}
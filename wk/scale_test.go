@@ -0,0 +1,145 @@
+package wk
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPool_Resize(t *testing.T) {
+	var running, peak int32
+	block := make(chan struct{})
+
+	p := NewPool(context.Background(), 1, WithQueueSize(10))
+	p.Start()
+	p.Resize(4)
+
+	for i := 0; i < 4; i++ {
+		p.Do(NewTask(context.Background(), nil, func(context.Context, interface{}) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if n <= old || atomic.CompareAndSwapInt32(&peak, old, n) {
+					break
+				}
+			}
+
+			<-block
+			atomic.AddInt32(&running, -1)
+			return nil
+		}))
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&peak) < 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := atomic.LoadInt32(&peak); got != 4 {
+		t.Errorf("Resize(4) ran %v tasks concurrently, want 4", got)
+	}
+
+	p.Resize(2)
+	close(block)
+
+	if s := p.Stats(); s.Workers != 2 {
+		t.Errorf("Stats().Workers = %v, want 2", s.Workers)
+	}
+
+	p.Stop()
+	if s := p.Stats(); s.Completed != 4 || s.Active != 0 {
+		t.Errorf("Stats() = %+v, want 4 completed and no active", s)
+	}
+}
+
+func TestPool_scale(t *testing.T) {
+	cfg := &AutoscaleConfig{Min: 1, Max: 3, MaxWait: 10 * time.Millisecond, IdleTime: time.Minute}
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		stats       Stats
+		idleSince   time.Time
+		wantWorkers int
+		wantIdle    time.Time
+	}{
+		{
+			name:        "grow on long wait",
+			stats:       Stats{Workers: 2, Active: 2, Queued: 5, Wait: time.Second},
+			wantWorkers: 3,
+		},
+		{
+			name:        "bounded by max",
+			stats:       Stats{Workers: 3, Active: 3, Queued: 5, Wait: time.Second},
+			wantWorkers: 3,
+		},
+		{
+			name:        "start idle period",
+			stats:       Stats{Workers: 2, Active: 1},
+			wantWorkers: 2,
+			wantIdle:    now,
+		},
+		{
+			name:        "shrink after idle period",
+			stats:       Stats{Workers: 2},
+			idleSince:   now.Add(-2 * time.Minute),
+			wantWorkers: 1,
+			wantIdle:    now,
+		},
+		{
+			name:        "bounded by min",
+			stats:       Stats{Workers: 1},
+			idleSince:   now.Add(-2 * time.Minute),
+			wantWorkers: 1,
+			wantIdle:    now.Add(-2 * time.Minute),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPool(context.Background(), tt.stats.Workers)
+
+			got := p.scale(cfg, tt.stats, tt.idleSince, now)
+			if !got.Equal(tt.wantIdle) {
+				t.Errorf("scale() idle since = %v, want %v", got, tt.wantIdle)
+			}
+			if p.numberWorker != tt.wantWorkers {
+				t.Errorf("scale() workers = %v, want %v", p.numberWorker, tt.wantWorkers)
+			}
+		})
+	}
+}
+
+func TestPool_Autoscale(t *testing.T) {
+	p := NewPool(context.Background(), 1, WithQueueSize(100), WithAutoscale(AutoscaleConfig{
+		Min:      1,
+		Max:      4,
+		MaxWait:  time.Millisecond,
+		IdleTime: 20 * time.Millisecond,
+		Interval: 5 * time.Millisecond,
+	}))
+	p.Start()
+	defer p.Stop()
+
+	for i := 0; i < 50; i++ {
+		p.Do(NewTask(context.Background(), nil, func(context.Context, interface{}) error {
+			time.Sleep(5 * time.Millisecond)
+			return nil
+		}))
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for p.Stats().Workers == 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if s := p.Stats(); s.Workers == 1 {
+		t.Errorf("autoscaler did not grow, Stats() = %+v", s)
+	}
+
+	deadline = time.Now().Add(2 * time.Second)
+	for p.Stats().Workers > 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if s := p.Stats(); s.Workers != 1 {
+		t.Errorf("autoscaler did not shrink, Stats() = %+v", s)
+	}
+}
@@ -0,0 +1,321 @@
+package wk
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Errors of scheduling jobs
+var (
+	ErrJobExists   = errors.New("wk: job already exists")
+	ErrJobNotFound = errors.New("wk: job not found")
+)
+
+// Clock tells time to the scheduler, it is replaced by a fake one in tests
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is the part of time.Timer used by the scheduler
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+type realClock struct{}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (realClock) Now() time.Time                 { return time.Now() }
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+func (t realTimer) C() <-chan time.Time          { return t.Timer.C }
+
+// Entry describes a scheduled job
+type Entry struct {
+	Name    string
+	Next    time.Time
+	Prev    time.Time
+	Running bool
+}
+
+// Scheduler runs jobs periodically on a pool.
+// A run is skipped while the previous run of the job is not done or the pool queue is full.
+type Scheduler struct {
+	ctx   context.Context
+	pool  *Pool
+	clock Clock
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	wake    chan struct{}
+	quit    chan struct{}
+	done    chan struct{}
+	started bool
+}
+
+type job struct {
+	name     string
+	schedule Schedule
+	fn       func(context.Context) error
+	jitter   time.Duration
+	taskOpts []TaskOption
+
+	base    time.Time // activation time without jitter
+	next    time.Time
+	prev    time.Time
+	running bool
+}
+
+// SchedulerOption configures a scheduler
+type SchedulerOption func(*Scheduler)
+
+// WithClock replaces the wall clock
+func WithClock(c Clock) SchedulerOption {
+	return func(s *Scheduler) {
+		s.clock = c
+	}
+}
+
+// JobOption configures a job
+type JobOption func(*job)
+
+// WithJitter delays each run by a random duration up to d
+func WithJitter(d time.Duration) JobOption {
+	return func(j *job) {
+		j.jitter = d
+	}
+}
+
+// WithJobTaskOptions applies task options such as retries to each run
+func WithJobTaskOptions(opts ...TaskOption) JobOption {
+	return func(j *job) {
+		j.taskOpts = append(j.taskOpts, opts...)
+	}
+}
+
+// NewScheduler create new scheduler running jobs on pool, the pool is started and stopped by the caller
+func NewScheduler(ctx context.Context, pool *Pool, opts ...SchedulerOption) *Scheduler {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	s := &Scheduler{
+		ctx:   ctx,
+		pool:  pool,
+		clock: realClock{},
+		jobs:  make(map[string]*job),
+		wake:  make(chan struct{}, 1),
+		quit:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Add a job activated by schedule
+func (s *Scheduler) Add(name string, schedule Schedule, fn func(context.Context) error, opts ...JobOption) error {
+	j := &job{
+		name:     name,
+		schedule: schedule,
+		fn:       fn,
+	}
+
+	for _, opt := range opts {
+		opt(j)
+	}
+
+	s.mu.Lock()
+	if _, ok := s.jobs[name]; ok {
+		s.mu.Unlock()
+		return ErrJobExists
+	}
+
+	j.base = schedule.Next(s.clock.Now())
+	j.next = j.withJitter()
+	s.jobs[name] = j
+	s.mu.Unlock()
+
+	signal(s.wake)
+	return nil
+}
+
+// AddCron adds a job activated by a cron expression evaluated in loc, see ParseCron
+func (s *Scheduler) AddCron(name, spec string, loc *time.Location, fn func(context.Context) error, opts ...JobOption) error {
+	schedule, err := ParseCron(spec, loc)
+	if err != nil {
+		return err
+	}
+
+	return s.Add(name, schedule, fn, opts...)
+}
+
+// Remove a job, its running task is not interrupted
+func (s *Scheduler) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[name]; !ok {
+		return ErrJobNotFound
+	}
+
+	delete(s.jobs, name)
+	return nil
+}
+
+// NextRun returns the next activation time of a job
+func (s *Scheduler) NextRun(name string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, ok := s.jobs[name]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return j.next, true
+}
+
+// Entries returns all jobs sorted by next activation time
+func (s *Scheduler) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]Entry, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		entries = append(entries, Entry{Name: j.name, Next: j.next, Prev: j.prev, Running: j.running})
+	}
+
+	sort.Slice(entries, func(i, k int) bool {
+		return entries[i].Next.Before(entries[k].Next)
+	})
+
+	return entries
+}
+
+// Start scheduling
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return
+	}
+	s.started = true
+
+	go s.run()
+}
+
+// Stop scheduling and wait the loop exit, running tasks are left to the pool
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	started := s.started
+	select {
+	case <-s.quit:
+	default:
+		close(s.quit)
+	}
+	s.mu.Unlock()
+
+	if started {
+		<-s.done
+	}
+}
+
+func (s *Scheduler) run() {
+	defer close(s.done)
+
+	for {
+		now := s.clock.Now()
+		wait := s.dispatch(now)
+
+		timer := s.clock.NewTimer(wait)
+		select {
+		case <-s.quit:
+			timer.Stop()
+			return
+		case <-s.ctx.Done():
+			timer.Stop()
+			return
+		case <-s.wake:
+			timer.Stop()
+		case <-timer.C():
+		}
+	}
+}
+
+// dispatch submits due jobs and returns the duration until the next one
+func (s *Scheduler) dispatch(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wait := time.Hour
+	for _, j := range s.jobs {
+		if j.next.IsZero() {
+			continue
+		}
+
+		if !j.next.After(now) {
+			if !j.running {
+				s.submit(j, now)
+			}
+
+			// skip activations missed while running or sleeping
+			for !j.base.After(now) {
+				j.base = j.schedule.Next(j.base)
+				if j.base.IsZero() {
+					break
+				}
+			}
+			j.next = j.withJitter()
+		}
+
+		if j.next.IsZero() {
+			continue
+		}
+
+		if d := j.next.Sub(now); d < wait {
+			wait = d
+		}
+	}
+
+	return wait
+}
+
+// submit requires s.mu held
+func (s *Scheduler) submit(j *job, now time.Time) {
+	fn := j.fn
+	t := NewTask(s.ctx, nil, func(ctx context.Context, _ interface{}) error {
+		return fn(ctx)
+	}, j.taskOpts...)
+
+	t.onDone = func(Result) {
+		s.mu.Lock()
+		j.running = false
+		s.mu.Unlock()
+	}
+
+	j.running = true
+	j.prev = now
+	if err := s.pool.TryDo(t); err != nil {
+		j.running = false
+	}
+}
+
+func (j *job) withJitter() time.Time {
+	if j.jitter <= 0 || j.base.IsZero() {
+		return j.base
+	}
+
+	return j.base.Add(time.Duration(rand.Int63n(int64(j.jitter))))
+}
@@ -0,0 +1,231 @@
+package wk
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []*fakeTimer
+	created chan struct{}
+}
+
+type fakeTimer struct {
+	clock   *fakeClock
+	at      time.Time
+	c       chan time.Time
+	stopped bool
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, created: make(chan struct{}, 100)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{clock: c, at: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	c.created <- struct{}{}
+	return t
+}
+
+// Advance moves time forward after the scheduler waits on a new timer
+func (c *fakeClock) Advance(d time.Duration) {
+	<-c.created
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	timers := c.timers[:0]
+	for _, t := range c.timers {
+		if t.stopped {
+			continue
+		}
+
+		if !t.at.After(c.now) {
+			t.c <- c.now
+			continue
+		}
+		timers = append(timers, t)
+	}
+	c.timers = timers
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	t.stopped = true
+	return true
+}
+
+func TestScheduler_Every(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+
+	pool := NewPool(context.Background(), 1)
+	pool.Start()
+	defer pool.Stop()
+
+	runs := make(chan struct{}, 10)
+	s := NewScheduler(context.Background(), pool, WithClock(clock))
+	_ = s.Add("tick", Every(time.Minute), func(context.Context) error {
+		runs <- struct{}{}
+		return nil
+	})
+	s.Start()
+	defer s.Stop()
+
+	if next, _ := s.NextRun("tick"); !next.Equal(start.Add(time.Minute)) {
+		t.Errorf("NextRun() = %v, want %v", next, start.Add(time.Minute))
+	}
+
+	for i := 1; i <= 3; i++ {
+		clock.Advance(time.Minute)
+		<-runs
+	}
+
+	if next, _ := s.NextRun("tick"); !next.Equal(start.Add(4 * time.Minute)) {
+		t.Errorf("NextRun() = %v, want %v", next, start.Add(4*time.Minute))
+	}
+
+	if err := s.Add("tick", Every(time.Second), nil); err != ErrJobExists {
+		t.Errorf("Add() duplicated error = %v, want %v", err, ErrJobExists)
+	}
+}
+
+func TestScheduler_NoOverlap(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+
+	pool := NewPool(context.Background(), 2)
+	pool.Start()
+	defer pool.Stop()
+
+	runs := make(chan struct{}, 10)
+	release := make(chan struct{})
+	s := NewScheduler(context.Background(), pool, WithClock(clock))
+	_ = s.Add("slow", Every(time.Minute), func(context.Context) error {
+		runs <- struct{}{}
+		<-release
+		return nil
+	})
+	s.Start()
+	defer s.Stop()
+
+	clock.Advance(time.Minute)
+	<-runs
+
+	clock.Advance(time.Minute)
+	clock.Advance(time.Minute)
+	select {
+	case <-runs:
+		t.Fatal("job ran while the previous run was not done")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	release <- struct{}{}
+	deadline := time.Now().Add(time.Second)
+	for s.Entries()[0].Running && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	clock.Advance(time.Minute)
+	<-runs
+	close(release)
+}
+
+func TestScheduler_Jitter(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewScheduler(context.Background(), nil, WithClock(newFakeClock(start)))
+
+	for i := 0; i < 20; i++ {
+		name := string(rune('a' + i))
+		_ = s.Add(name, Every(time.Minute), nil, WithJitter(10*time.Second))
+
+		next, _ := s.NextRun(name)
+		if next.Before(start.Add(time.Minute)) || !next.Before(start.Add(time.Minute+10*time.Second)) {
+			t.Errorf("NextRun() = %v, want within 10s jitter after %v", next, start.Add(time.Minute))
+		}
+	}
+}
+
+func TestScheduler_StopConcurrent(t *testing.T) {
+	s := NewScheduler(context.Background(), nil, WithClock(newFakeClock(time.Now())))
+	s.Start()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Stop()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestParseCron(t *testing.T) {
+	hcm := time.FixedZone("ICT", 7*3600)
+	from := time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC) // Wednesday
+
+	tests := []struct {
+		spec    string
+		loc     *time.Location
+		want    time.Time
+		wantErr bool
+	}{
+		{spec: "* * * * *", want: time.Date(2020, 1, 1, 10, 31, 0, 0, time.UTC)},
+		{spec: "*/15 * * * *", want: time.Date(2020, 1, 1, 10, 45, 0, 0, time.UTC)},
+		{spec: "0 9 * * mon-fri", want: time.Date(2020, 1, 2, 9, 0, 0, 0, time.UTC)},
+		{spec: "0 9 * * mon-fri", loc: hcm, want: time.Date(2020, 1, 2, 2, 0, 0, 0, time.UTC)},
+		{spec: "0 12 * * 7", want: time.Date(2020, 1, 5, 12, 0, 0, 0, time.UTC)},
+		{spec: "0 0 13 * fri", want: time.Date(2020, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 29 feb *", want: time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{spec: "5,35 1-3 * * *", want: time.Date(2020, 1, 2, 1, 5, 0, 0, time.UTC)},
+		{spec: "@monthly", want: time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{spec: "@every 90s", want: from.Add(90 * time.Second)},
+		{spec: "0 0 30 2 *", want: time.Time{}},
+		{spec: "* * * *", wantErr: true},
+		{spec: "60 * * * *", wantErr: true},
+		{spec: "*/0 * * * *", wantErr: true},
+		{spec: "5-1 * * * *", wantErr: true},
+		{spec: "@every -1s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			loc := tt.loc
+			if loc == nil {
+				loc = time.UTC
+			}
+
+			s, err := ParseCron(tt.spec, loc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCron() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if got := s.Next(from); !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
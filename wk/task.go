@@ -2,6 +2,15 @@ package wk
 
 import (
 	"context"
+	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/sunary/kitchen/e"
+	"github.com/sunary/kitchen/rt"
+	"google.golang.org/grpc/status"
 )
 
 // Task represents a task
@@ -9,20 +18,194 @@ type Task struct {
 	ctx      context.Context
 	info     interface{}
 	executor func(context.Context, interface{}) error
+
+	maxAttempts    int
+	baseDelay      time.Duration
+	maxDelay       time.Duration
+	attemptTimeout time.Duration
+	retryable      func(error) bool
+	priority       Priority
+
+	result Result
+	done   chan struct{}
+	once   sync.Once
+	onDone func(Result)
+}
+
+// Result of an executed task
+type Result struct {
+	// Attempts is the number of times the executor was called
+	Attempts int
+	// Err is the error returned by the last attempt
+	Err error
+}
+
+// PanicError is returned as task error when the executor panics
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// Error ...
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", p.Value, p.Stack)
+}
+
+// TaskOption configures a task
+type TaskOption func(*Task)
+
+// WithMaxAttempts sets how many times the executor is called before giving up, default 1
+func WithMaxAttempts(n int) TaskOption {
+	return func(t *Task) {
+		if n > 0 {
+			t.maxAttempts = n
+		}
+	}
+}
+
+// WithBackoff waits between attempts as computed by Backoff
+func WithBackoff(base, max time.Duration) TaskOption {
+	return func(t *Task) {
+		t.baseDelay = base
+		t.maxDelay = max
+	}
+}
+
+// WithAttemptTimeout limits each attempt with a timeout derived from the task context
+func WithAttemptTimeout(d time.Duration) TaskOption {
+	return func(t *Task) {
+		t.attemptTimeout = d
+	}
+}
+
+// WithRetryable sets the classifier deciding whether a failed attempt is retried, default retries all errors
+func WithRetryable(fn func(error) bool) TaskOption {
+	return func(t *Task) {
+		t.retryable = fn
+	}
+}
+
+// WithPriority sets the task priority in pool, default PriorityNormal
+func WithPriority(p Priority) TaskOption {
+	return func(t *Task) {
+		t.priority = p
+	}
+}
+
+// RetryOnCodes retries only errors carrying one of the status codes, such as e.Status
+func RetryOnCodes(codes ...e.Code) func(error) bool {
+	m := make(map[e.Code]struct{}, len(codes))
+	for _, c := range codes {
+		m[c] = struct{}{}
+	}
+
+	return func(err error) bool {
+		_, ok := m[e.Code(status.Code(err))]
+		return ok
+	}
 }
 
 // NewTask create new task
-func NewTask(ctx context.Context, taskInfo interface{}, executor func(context.Context, interface{}) error) *Task {
-	return &Task{
-		ctx:      ctx,
-		info:     taskInfo,
-		executor: executor,
+func NewTask(ctx context.Context, taskInfo interface{}, executor func(context.Context, interface{}) error, opts ...TaskOption) *Task {
+	if ctx == nil {
+		ctx = context.Background()
 	}
+
+	t := &Task{
+		ctx:         ctx,
+		info:        taskInfo,
+		executor:    executor,
+		maxAttempts: 1,
+		priority:    PriorityNormal,
+		done:        make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	return t
 }
 
-// Execute task
+// Execute task. A panic in the executor is recovered and reported as *PanicError.
 func (t *Task) Execute() {
-	if t.executor != nil {
-		_ = t.executor(t.ctx, t.info)
+	t.execute()
+}
+
+// execute calls handlers with the recovered value whenever an attempt panics
+func (t *Task) execute(handlers ...func(interface{})) {
+	defer t.once.Do(func() {
+		if t.onDone != nil {
+			t.onDone(t.result)
+		}
+		close(t.done)
+	})
+
+	if t.executor == nil {
+		return
+	}
+
+	for attempt := 1; attempt <= t.maxAttempts; attempt++ {
+		t.result.Attempts = attempt
+		t.result.Err = t.attempt(handlers)
+		if t.result.Err == nil || attempt == t.maxAttempts {
+			return
+		}
+
+		if t.retryable != nil && !t.retryable(t.result.Err) {
+			return
+		}
+
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-time.After(Backoff(t.baseDelay, t.maxDelay, attempt)):
+		}
+	}
+}
+
+// Done is closed after the task is executed
+func (t *Task) Done() <-chan struct{} {
+	return t.done
+}
+
+// Result returns the outcome of Execute, it is only complete after Done is closed
+func (t *Task) Result() Result {
+	return t.result
+}
+
+func (t *Task) attempt(handlers []func(interface{})) (err error) {
+	recovered := func(r interface{}) {
+		err = &PanicError{Value: r, Stack: debug.Stack()}
 	}
+	defer rt.HandleCrash(append([]func(interface{}){recovered}, handlers...)...)
+
+	ctx := t.ctx
+	if t.attemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.attemptTimeout)
+		defer cancel()
+	}
+
+	return t.executor(ctx, t.info)
+}
+
+// Backoff returns the delay before retrying after attempt, starting from base and doubled
+// each attempt up to max, zero max means no cap. Half of the delay is randomized to spread out retries.
+func Backoff(base, max time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+
+	d := base
+	for i := 1; i < attempt && (max <= 0 || d < max); i++ {
+		d *= 2
+	}
+
+	if max > 0 && d > max {
+		d = max
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
 }
@@ -0,0 +1,110 @@
+package wk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sunary/kitchen/e"
+	"google.golang.org/grpc/codes"
+)
+
+func TestTask_Retry(t *testing.T) {
+	unavailable := e.Error(e.Code(codes.Unavailable), "unavailable")
+	invalid := e.Error(e.Code(codes.InvalidArgument), "invalid")
+
+	tests := []struct {
+		name         string
+		errs         []error
+		opts         []TaskOption
+		wantAttempts int
+		wantErr      error
+	}{
+		{
+			name:         "no retry by default",
+			errs:         []error{unavailable, nil},
+			wantAttempts: 1,
+			wantErr:      unavailable,
+		},
+		{
+			name:         "retry until success",
+			errs:         []error{unavailable, unavailable, nil},
+			opts:         []TaskOption{WithMaxAttempts(5), WithBackoff(time.Millisecond, 4*time.Millisecond)},
+			wantAttempts: 3,
+		},
+		{
+			name:         "give up after max attempts",
+			errs:         []error{unavailable, unavailable, unavailable, unavailable},
+			opts:         []TaskOption{WithMaxAttempts(3)},
+			wantAttempts: 3,
+			wantErr:      unavailable,
+		},
+		{
+			name:         "stop on non retryable code",
+			errs:         []error{unavailable, invalid, nil},
+			opts:         []TaskOption{WithMaxAttempts(5), WithRetryable(RetryOnCodes(e.Code(codes.Unavailable)))},
+			wantAttempts: 2,
+			wantErr:      invalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			task := NewTask(context.Background(), nil, func(context.Context, interface{}) error {
+				err := tt.errs[calls]
+				calls++
+				return err
+			}, tt.opts...)
+
+			task.Execute()
+			<-task.Done()
+
+			got := task.Result()
+			if got.Attempts != tt.wantAttempts {
+				t.Errorf("Result().Attempts = %v, want %v", got.Attempts, tt.wantAttempts)
+			}
+			if got.Err != tt.wantErr {
+				t.Errorf("Result().Err = %v, want %v", got.Err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTask_AttemptTimeout(t *testing.T) {
+	task := NewTask(context.Background(), nil, func(ctx context.Context, _ interface{}) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, WithMaxAttempts(2), WithAttemptTimeout(5*time.Millisecond))
+
+	task.Execute()
+
+	got := task.Result()
+	if got.Attempts != 2 || !errors.Is(got.Err, context.DeadlineExceeded) {
+		t.Errorf("Result() = %+v, want 2 attempts with %v", got, context.DeadlineExceeded)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name      string
+		base, max time.Duration
+		attempt   int
+		want      time.Duration
+	}{
+		{name: "first", base: 10 * time.Millisecond, max: 50 * time.Millisecond, attempt: 1, want: 10 * time.Millisecond},
+		{name: "doubles", base: 10 * time.Millisecond, max: 50 * time.Millisecond, attempt: 3, want: 40 * time.Millisecond},
+		{name: "capped", base: 10 * time.Millisecond, max: 50 * time.Millisecond, attempt: 10, want: 50 * time.Millisecond},
+		{name: "capped far", base: 10 * time.Millisecond, max: 50 * time.Millisecond, attempt: 100, want: 50 * time.Millisecond},
+		{name: "uncapped", base: 10 * time.Millisecond, attempt: 4, want: 80 * time.Millisecond},
+		{name: "no base", max: 50 * time.Millisecond, attempt: 3},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			// half of the delay is jitter
+			if got := Backoff(tt.base, tt.max, tt.attempt); got < tt.want/2 || got > tt.want {
+				t.Fatalf("%v: Backoff(%v) = %v, want in [%v, %v]", tt.name, tt.attempt, got, tt.want/2, tt.want)
+			}
+		}
+	}
+}